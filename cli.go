@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"shortlink-service/shortner"
+)
+
+// runCommand runs a subcommand of the binary instead of the server:
+//
+//	export [file]  writes every shortlink as NDJSON to file, stdout if omitted
+//	import [file]  imports the NDJSON shortlinks of file, stdin if omitted
+func runCommand(ctx context.Context, c *shortner.Client, args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("too many arguments, usage: %s export|import [file]", os.Args[0])
+	}
+	switch args[0] {
+	case "export":
+		if len(args) == 1 {
+			return exportTo(ctx, c, os.Stdout)
+		}
+		f, err := os.Create(args[1])
+		if err != nil {
+			return err
+		}
+		err = exportTo(ctx, c, f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	case "import":
+		if len(args) == 1 {
+			return importFrom(ctx, c, os.Stdin)
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return importFrom(ctx, c, f)
+	default:
+		return fmt.Errorf("unknown command %s, usage: %s export|import [file]", args[0], os.Args[0])
+	}
+}
+
+func exportTo(ctx context.Context, c *shortner.Client, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	n, err := c.ExportShortLinks(ctx, w)
+	if err != nil {
+		return err
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	log.Printf("exported %d shortlinks", n)
+	return nil
+}
+
+func importFrom(ctx context.Context, c *shortner.Client, in io.Reader) error {
+	n, err := c.ImportShortLinks(ctx, bufio.NewReader(in))
+	log.Printf("imported %d shortlinks", n)
+	return err
+}
@@ -0,0 +1,458 @@
+package dbbolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"shortlink-service/shortlink"
+	"strconv"
+	"time"
+)
+
+const defaultTimeout = time.Second
+
+var (
+	itemsBucket     = []byte("items")
+	revisionsBucket = []byte("revisions")
+)
+
+type Config struct {
+	Path string
+	// Timeout is how long New waits for the file lock of another process, 1 second if zero.
+	Timeout time.Duration
+}
+
+// Client stores the items as JSON in a bbolt file. Items are keyed by their
+// key, revisions by the item key and the big endian version, so the
+// revisions of an item are adjacent and ordered.
+type Client struct {
+	db *bolt.DB
+}
+
+func New(ctx context.Context, config Config) (*Client, error) {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	db, err := bolt.Open(config.Path, 0600, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{itemsBucket, revisionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Client{db: db}, nil
+}
+
+func (c *Client) Get(ctx context.Context, key string) (*shortlink.Item, error) {
+	var item *shortlink.Item
+	err := c.db.View(func(tx *bolt.Tx) error {
+		var err error
+		item, err = getActive(tx, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (c *Client) Set(ctx context.Context, key string, data *shortlink.Item) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(itemsBucket).Get([]byte(key)) != nil {
+			return fmt.Errorf("%w: %s", shortlink.ErrKeyExists, key)
+		}
+		return putItem(tx, key, newItem(data))
+	})
+}
+
+func (c *Client) Update(ctx context.Context, key string, data *shortlink.Item, version int) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		item, err := getActive(tx, key)
+		if err != nil {
+			return err
+		}
+		if item.Version != version {
+			return fmt.Errorf("%w: item with key %s is at version %d", shortlink.ErrVersionConflict, key, item.Version)
+		}
+		item.Redirects = data.Redirects
+		item.Timezone = data.Timezone
+		item.ExpiresAt = data.ExpiresAt
+		item.UpdatedAt = data.UpdatedAt
+		item.Version++
+		return putItem(tx, key, item)
+	})
+}
+
+func (c *Client) AddRevision(ctx context.Context, rev *shortlink.Revision) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(revisionsBucket)
+		revKey := revisionKey(rev.Key, rev.Version)
+		if b.Get(revKey) != nil {
+			return fmt.Errorf("%w: revision %d of %s", shortlink.ErrKeyExists, rev.Version, rev.Key)
+		}
+		data, err := json.Marshal(rev)
+		if err != nil {
+			return err
+		}
+		return b.Put(revKey, data)
+	})
+}
+
+func (c *Client) ListRevisions(ctx context.Context, key string) ([]*shortlink.Revision, error) {
+	revs := make([]*shortlink.Revision, 0)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		prefix := revisionPrefix(key)
+		cur := tx.Bucket(revisionsBucket).Cursor()
+		for k, v := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cur.Next() {
+			var rev shortlink.Revision
+			err := json.Unmarshal(v, &rev)
+			if err != nil {
+				return err
+			}
+			revs = append(revs, &rev)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+func (c *Client) CreateGetID(ctx context.Context, data *shortlink.Item) (uint64, error) {
+	var id uint64
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		id, err = tx.Bucket(itemsBucket).NextSequence()
+		if err != nil {
+			return err
+		}
+		return putItem(tx, strconv.FormatUint(id, 10), newItem(data))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (c *Client) Import(ctx context.Context, key string, data *shortlink.Item) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		// the delete drops the revisions of the replaced item
+		err := deleteItem(tx, []byte(key))
+		if err != nil {
+			return err
+		}
+		item := *data
+		err = putItem(tx, key, &item)
+		if err != nil {
+			return err
+		}
+		b := tx.Bucket(itemsBucket)
+		if id, ok := shortlink.StandardID(key, data); ok && id > b.Sequence() {
+			return b.SetSequence(id)
+		}
+		return nil
+	})
+}
+
+// Delete soft deletes the item, it is kept until purged.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		item, err := getItem(tx, key)
+		if err != nil || item.State == shortlink.StateDeleted {
+			return nil
+		}
+		now := time.Now().UTC()
+		item.State = shortlink.StateDeleted
+		item.DeletedAt = &now
+		return putItem(tx, key, item)
+	})
+}
+
+func (c *Client) ListDeleted(ctx context.Context, after string, limit int) ([]*shortlink.Item, error) {
+	return c.list(after, limit, shortlink.StateDeleted)
+}
+
+func (c *Client) Restore(ctx context.Context, key string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		item, err := getItem(tx, key)
+		if err != nil || item.State != shortlink.StateDeleted {
+			return fmt.Errorf("%w: deleted item %s", shortlink.ErrNotFound, key)
+		}
+		item.State = shortlink.StateActive
+		item.DeletedAt = nil
+		return putItem(tx, key, item)
+	})
+}
+
+// Purge removes the items deleted before the given time, with their revisions.
+func (c *Client) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return c.remove(func(item *shortlink.Item) bool {
+		return item.State == shortlink.StateDeleted && (item.DeletedAt == nil || item.DeletedAt.Before(deletedBefore))
+	})
+}
+
+func (c *Client) Remove(ctx context.Context, key string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return deleteItem(tx, []byte(key))
+	})
+}
+
+func (c *Client) IncVisits(ctx context.Context, key string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		item, err := getActive(tx, key)
+		if err != nil {
+			return err
+		}
+		item.Visits++
+		return putItem(tx, key, item)
+	})
+}
+
+// AddVisits adds all counts in one transaction.
+func (c *Client) AddVisits(ctx context.Context, visits map[string]int) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		for key, n := range visits {
+			item, err := getActive(tx, key)
+			if err != nil {
+				continue
+			}
+			item.Visits += n
+			err = putItem(tx, key, item)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *Client) GetVisits(ctx context.Context, key string) (int, error) {
+	var visits int
+	err := c.db.View(func(tx *bolt.Tx) error {
+		item, err := getItem(tx, key)
+		if err != nil {
+			return err
+		}
+		visits = item.Visits
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return visits, nil
+}
+
+func (c *Client) List(ctx context.Context, after string, limit int) ([]*shortlink.Item, error) {
+	return c.list(after, limit, shortlink.StateActive)
+}
+
+// list returns up to limit items in the state with a key greater than after.
+func (c *Client) list(after string, limit int, state shortlink.State) ([]*shortlink.Item, error) {
+	var items []*shortlink.Item
+	err := c.db.View(func(tx *bolt.Tx) error {
+		cur := tx.Bucket(itemsBucket).Cursor()
+		k, v := cur.Seek([]byte(after))
+		if k != nil && string(k) == after {
+			k, v = cur.Next()
+		}
+		for ; k != nil && len(items) < limit; k, v = cur.Next() {
+			var item shortlink.Item
+			err := json.Unmarshal(v, &item)
+			if err != nil {
+				return err
+			}
+			if item.State == state {
+				items = append(items, &item)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (c *Client) Query(ctx context.Context, q *shortlink.Query) (*shortlink.QueryResult, error) {
+	items, err := c.find(q.Match)
+	if err != nil {
+		return nil, err
+	}
+	q.Sort(items)
+	return &shortlink.QueryResult{Items: q.Page(items), Total: len(items)}, nil
+}
+
+// PurgeExpired removes all items that are expired at the given time and
+// returns the number of removed items.
+func (c *Client) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	return c.remove(func(item *shortlink.Item) bool {
+		return item.Expired(now)
+	})
+}
+
+// StartSweeper purges the items expired longer than retention ago every
+// interval until ctx is done. Until then expired items respond 410 Gone.
+func (c *Client) StartSweeper(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				_, err := c.PurgeExpired(ctx, now.Add(-retention))
+				if err != nil {
+					fmt.Printf("error purging expired items: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+// find walks the items bucket with a cursor and returns the matching items.
+func (c *Client) find(match func(item *shortlink.Item) bool) ([]*shortlink.Item, error) {
+	var items []*shortlink.Item
+	err := c.db.View(func(tx *bolt.Tx) error {
+		cur := tx.Bucket(itemsBucket).Cursor()
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			var item shortlink.Item
+			err := json.Unmarshal(v, &item)
+			if err != nil {
+				return err
+			}
+			if match(&item) {
+				items = append(items, &item)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// remove deletes the matching items and their revisions in one transaction.
+func (c *Client) remove(match func(item *shortlink.Item) bool) (int, error) {
+	var removed int
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		var keys [][]byte
+		err := tx.Bucket(itemsBucket).ForEach(func(k, v []byte) error {
+			var item shortlink.Item
+			err := json.Unmarshal(v, &item)
+			if err != nil {
+				return err
+			}
+			if match(&item) {
+				// the key is only valid until the bucket is changed
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			err := deleteItem(tx, k)
+			if err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+func getItem(tx *bolt.Tx, key string) (*shortlink.Item, error) {
+	v := tx.Bucket(itemsBucket).Get([]byte(key))
+	if v == nil {
+		return nil, fmt.Errorf("%w: %s", shortlink.ErrNotFound, key)
+	}
+	var item shortlink.Item
+	err := json.Unmarshal(v, &item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func getActive(tx *bolt.Tx, key string) (*shortlink.Item, error) {
+	item, err := getItem(tx, key)
+	if err != nil {
+		return nil, err
+	}
+	if item.State == shortlink.StateDeleted {
+		return nil, fmt.Errorf("%w: %s", shortlink.ErrDeleted, key)
+	}
+	return item, nil
+}
+
+func putItem(tx *bolt.Tx, key string, item *shortlink.Item) error {
+	item.Key = key
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(itemsBucket).Put([]byte(key), data)
+}
+
+func deleteItem(tx *bolt.Tx, key []byte) error {
+	err := tx.Bucket(itemsBucket).Delete(key)
+	if err != nil {
+		return err
+	}
+	var revKeys [][]byte
+	prefix := revisionPrefix(string(key))
+	cur := tx.Bucket(revisionsBucket).Cursor()
+	for k, _ := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cur.Next() {
+		revKeys = append(revKeys, append([]byte(nil), k...))
+	}
+	for _, k := range revKeys {
+		err := tx.Bucket(revisionsBucket).Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func revisionPrefix(key string) []byte {
+	// keys never contain a zero byte, so the prefix of a key can't match a longer key
+	return append([]byte(key), 0)
+}
+
+func revisionKey(key string, version int) []byte {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(version))
+	return append(revisionPrefix(key), v...)
+}
+
+func newItem(data *shortlink.Item) *shortlink.Item {
+	item := *data
+	item.State = shortlink.StateActive
+	return &item
+}
@@ -0,0 +1,211 @@
+package dbbolt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"shortlink-service/dbtest"
+	"shortlink-service/shortlink"
+	"shortlink-service/shortner"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "shortlinks.db")
+	c, err := New(ctx, Config{Path: path})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+
+	item := shortlink.Item{
+		Redirects: []shortlink.Redirect{
+			{From: 0, To: 24, URL: "https://google.com"},
+		},
+		Version: 1,
+	}
+
+	t.Log("Testing key concurrent increments...")
+	count := 200
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.CreateGetID(ctx, &item)
+			if err != nil {
+				t.Errorf("Error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	items, err := c.List(ctx, "", count+1)
+	if err != nil {
+		t.Fatalf("error getting results: %v", err)
+	}
+	if len(items) != count {
+		t.Errorf("items mismatch. expected: %d, got: %d", count, len(items))
+	}
+
+	t.Log("Testing get...")
+	key := strconv.Itoa(count)
+	slItem, err := c.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("error getting shortlink item: %v", err)
+	}
+	if slItem.Key != key || slItem.Redirects[0].URL != "https://google.com" {
+		t.Errorf("got wrong item: %+v", slItem)
+	}
+	if err := c.Set(ctx, key, &item); !errors.Is(err, shortlink.ErrKeyExists) {
+		t.Errorf("expected key exists error, got: %v", err)
+	}
+
+	t.Log("Testing visits...")
+	visCount := 300
+	for i := 0; i < visCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.IncVisits(ctx, key)
+			if err != nil {
+				t.Errorf("Error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	v, err := c.GetVisits(ctx, key)
+	if err != nil {
+		t.Fatalf("error get key vists: %v", err)
+	}
+	if v != visCount {
+		t.Errorf("visits mismatch. expected: %d, got: %d", visCount, v)
+	}
+
+	t.Log("Testing update and revisions...")
+	if err := c.Update(ctx, key, &shortlink.Item{Redirects: item.Redirects}, 2); !errors.Is(err, shortlink.ErrVersionConflict) {
+		t.Errorf("expected version conflict error, got: %v", err)
+	}
+	if err := c.Update(ctx, key, &shortlink.Item{Redirects: item.Redirects}, 1); err != nil {
+		t.Fatalf("error updating item: %v", err)
+	}
+	for _, version := range []int{2, 1} {
+		err := c.AddRevision(ctx, &shortlink.Revision{Key: key, Version: version, Redirects: item.Redirects})
+		if err != nil {
+			t.Fatalf("error adding revision: %v", err)
+		}
+	}
+	if err := c.AddRevision(ctx, &shortlink.Revision{Key: key, Version: 1}); !errors.Is(err, shortlink.ErrKeyExists) {
+		t.Errorf("expected key exists error for revision, got: %v", err)
+	}
+	err = c.AddRevision(ctx, &shortlink.Revision{Key: key + "0", Version: 1, Redirects: item.Redirects})
+	if err != nil {
+		t.Fatalf("error adding revision: %v", err)
+	}
+	revs, err := c.ListRevisions(ctx, key)
+	if err != nil {
+		t.Fatalf("error listing revisions: %v", err)
+	}
+	if len(revs) != 2 || revs[0].Version != 1 || revs[1].Version != 2 {
+		t.Errorf("revisions mismatch: %+v", revs)
+	}
+
+	t.Log("Testing delete lifecycle...")
+	if err := c.Delete(ctx, key); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	if _, err := c.Get(ctx, key); !errors.Is(err, shortlink.ErrDeleted) {
+		t.Errorf("expected deleted error, got: %v", err)
+	}
+	if err := c.Restore(ctx, key); err != nil {
+		t.Fatalf("error restoring item: %v", err)
+	}
+	if err := c.Delete(ctx, key); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	deleted, err := c.ListDeleted(ctx, "", 100)
+	if err != nil || len(deleted) != 1 {
+		t.Errorf("deleted items mismatch: %v (%v)", deleted, err)
+	}
+	if n, err := c.Purge(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Errorf("purged items mismatch. expected: %d, got: %d (%v)", 1, n, err)
+	}
+	if _, err := c.Get(ctx, key); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+	if revs, _ := c.ListRevisions(ctx, key); len(revs) != 0 {
+		t.Errorf("revisions of purged item were kept: %+v", revs)
+	}
+	if revs, _ := c.ListRevisions(ctx, key+"0"); len(revs) != 1 {
+		t.Errorf("revisions of another item were purged: %+v", revs)
+	}
+
+	t.Log("Testing reopen...")
+	if err := c.Close(); err != nil {
+		t.Fatalf("error closing dbClient: %v", err)
+	}
+	c, err = New(ctx, Config{Path: path})
+	if err != nil {
+		t.Fatalf("Error reopening dbClient: %v", err)
+	}
+	defer c.Close()
+	id, err := c.CreateGetID(ctx, &item)
+	if err != nil {
+		t.Fatalf("error creating key: %v", err)
+	}
+	if id != uint64(count+1) {
+		t.Errorf("sequence mismatch after reopen. expected: %d, got: %d", count+1, id)
+	}
+}
+
+func TestClient_PurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(ctx, Config{Path: filepath.Join(t.TempDir(), "shortlinks.db")})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+	defer c.Close()
+
+	expiresAt := time.Now().Add(time.Minute)
+	expiring := shortlink.Item{
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+		ExpiresAt: &expiresAt,
+	}
+	lasting := shortlink.Item{
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	}
+	expiringID, err := c.CreateGetID(ctx, &expiring)
+	if err != nil {
+		t.Fatalf("error creating key: %v", err)
+	}
+	lastingID, err := c.CreateGetID(ctx, &lasting)
+	if err != nil {
+		t.Fatalf("error creating key: %v", err)
+	}
+
+	if n, err := c.PurgeExpired(ctx, time.Now()); err != nil || n != 0 {
+		t.Errorf("purged %d items before expiry (%v)", n, err)
+	}
+	if n, err := c.PurgeExpired(ctx, expiresAt); err != nil || n != 1 {
+		t.Errorf("purged items mismatch. expected: %d, got: %d (%v)", 1, n, err)
+	}
+	if _, err := c.Get(ctx, strconv.FormatUint(expiringID, 10)); err == nil {
+		t.Error("expired item was not purged")
+	}
+	if _, err := c.Get(ctx, strconv.FormatUint(lastingID, 10)); err != nil {
+		t.Errorf("item without expiry was purged: %v", err)
+	}
+}
+
+func TestClient_Conformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) shortner.DbClient {
+		c, err := New(context.Background(), Config{Path: filepath.Join(t.TempDir(), "shortlinks.db")})
+		if err != nil {
+			t.Fatalf("Error creating dbClient: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	})
+}
@@ -0,0 +1,293 @@
+// Package dbcache wraps a shortner.DbClient with a read-through cache of items.
+package dbcache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log"
+	"shortlink-service/shortlink"
+	"shortlink-service/shortner"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSize        = 10000
+	defaultTTL         = time.Minute
+	defaultNegativeTTL = 5 * time.Second
+)
+
+type Config struct {
+	// Size is the maximum number of cached keys, 10000 if zero.
+	Size int
+	// TTL is how long an item is served from the cache, 1 minute if zero.
+	// Changes made through other instances are seen after at most TTL.
+	TTL time.Duration
+	// NegativeTTL is how long a missing or deleted key is served from the
+	// cache, 5 seconds if zero.
+	NegativeTTL time.Duration
+}
+
+type Stats struct {
+	Hits         uint64 `json:"hits"`
+	NegativeHits uint64 `json:"negativeHits"`
+	Misses       uint64 `json:"misses"`
+	Size         int    `json:"size"`
+}
+
+// Client caches the results of Get in a bounded LRU and passes every other
+// call through. The writes made through it invalidate the keys they change.
+type Client struct {
+	shortner.DbClient
+	config Config
+
+	sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   Stats
+	// generation is bumped by every invalidation, a lookup started before
+	// one may have read the old item and must not be cached
+	generation uint64
+}
+
+type entry struct {
+	key       string
+	item      *shortlink.Item
+	err       error
+	expiresAt time.Time
+}
+
+func New(dbClient shortner.DbClient, config Config) (*Client, error) {
+	if config.Size == 0 {
+		config.Size = defaultSize
+	}
+	if config.TTL == 0 {
+		config.TTL = defaultTTL
+	}
+	if config.NegativeTTL == 0 {
+		config.NegativeTTL = defaultNegativeTTL
+	}
+	if config.Size < 0 || config.TTL < 0 || config.NegativeTTL < 0 {
+		return nil, errors.New("cache size and ttls must be positive")
+	}
+	return &Client{
+		DbClient: dbClient,
+		config:   config,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}, nil
+}
+
+func (c *Client) Get(ctx context.Context, key string) (*shortlink.Item, error) {
+	item, err, generation, ok := c.lookup(key)
+	if ok {
+		return item, err
+	}
+
+	item, err = c.DbClient.Get(ctx, key)
+	switch {
+	case err == nil:
+		c.store(key, item, nil, c.config.TTL, generation)
+	case errors.Is(err, shortlink.ErrNotFound) || errors.Is(err, shortlink.ErrDeleted):
+		c.store(key, nil, err, c.config.NegativeTTL, generation)
+	default:
+		return nil, err
+	}
+	return copyItem(item), err
+}
+
+func (c *Client) Set(ctx context.Context, key string, data *shortlink.Item) error {
+	defer c.invalidate(key)
+	return c.DbClient.Set(ctx, key, data)
+}
+
+func (c *Client) CreateGetID(ctx context.Context, data *shortlink.Item) (uint64, error) {
+	id, err := c.DbClient.CreateGetID(ctx, data)
+	if err != nil {
+		return 0, err
+	}
+	// the ID may have been looked up, e.g. to check an alias, before it was created
+	c.invalidate(strconv.FormatUint(id, 10))
+	return id, nil
+}
+
+func (c *Client) Import(ctx context.Context, key string, data *shortlink.Item) error {
+	defer c.invalidate(key)
+	return c.DbClient.Import(ctx, key, data)
+}
+
+func (c *Client) Update(ctx context.Context, key string, data *shortlink.Item, version int) error {
+	defer c.invalidate(key)
+	return c.DbClient.Update(ctx, key, data, version)
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+	defer c.invalidate(key)
+	return c.DbClient.Delete(ctx, key)
+}
+
+func (c *Client) Restore(ctx context.Context, key string) error {
+	defer c.invalidate(key)
+	return c.DbClient.Restore(ctx, key)
+}
+
+// Purge drops the whole cache, as the purged keys are not known.
+func (c *Client) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	defer c.clear()
+	return c.DbClient.Purge(ctx, deletedBefore)
+}
+
+func (c *Client) Remove(ctx context.Context, key string) error {
+	defer c.invalidate(key)
+	return c.DbClient.Remove(ctx, key)
+}
+
+// IncVisits counts the visit in the cached item as well, so redirects don't
+// invalidate it. Visits counted by other instances show up after TTL.
+func (c *Client) IncVisits(ctx context.Context, key string) error {
+	err := c.DbClient.IncVisits(ctx, key)
+	if err != nil {
+		c.invalidate(key)
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry)
+		if e.item != nil {
+			item := *e.item
+			item.Visits++
+			e.item = &item
+		}
+	}
+	return nil
+}
+
+func (c *Client) AddVisits(ctx context.Context, visits map[string]int) error {
+	err := c.DbClient.AddVisits(ctx, visits)
+	failed := map[string]bool{}
+	var visitsErr *shortlink.VisitsError
+	if errors.As(err, &visitsErr) {
+		for _, key := range visitsErr.Keys {
+			failed[key] = true
+		}
+	} else if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for key, n := range visits {
+		el, ok := c.entries[key]
+		if !ok || failed[key] {
+			continue
+		}
+		e := el.Value.(*entry)
+		if e.item != nil {
+			item := *e.item
+			item.Visits += n
+			e.item = &item
+		}
+	}
+	return err
+}
+
+func (c *Client) Stats() Stats {
+	c.Lock()
+	defer c.Unlock()
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
+
+// StartReporter logs the cache statistics every interval until ctx is done.
+func (c *Client) StartReporter(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s := c.Stats()
+				log.Printf("cache: %d hits, %d negative hits, %d misses, %d keys", s.Hits, s.NegativeHits, s.Misses, s.Size)
+			}
+		}
+	}()
+}
+
+// lookup returns the cached result of key, or the current generation on a miss.
+func (c *Client) lookup(key string) (*shortlink.Item, error, uint64, bool) {
+	c.Lock()
+	defer c.Unlock()
+	el, ok := c.entries[key]
+	if ok && !time.Now().Before(el.Value.(*entry).expiresAt) {
+		c.remove(el)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, nil, c.generation, false
+	}
+
+	c.lru.MoveToFront(el)
+	e := el.Value.(*entry)
+	if e.err != nil {
+		c.stats.NegativeHits++
+		return nil, e.err, 0, true
+	}
+	c.stats.Hits++
+	return copyItem(e.item), nil, 0, true
+}
+
+func (c *Client) store(key string, item *shortlink.Item, err error, ttl time.Duration, generation uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if generation != c.generation {
+		return
+	}
+	e := &entry{key: key, item: copyItem(item), err: err, expiresAt: time.Now().Add(ttl)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.config.Size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Client) invalidate(key string) {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *Client) clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *Client) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
+
+func copyItem(item *shortlink.Item) *shortlink.Item {
+	if item == nil {
+		return nil
+	}
+	res := *item
+	return &res
+}
@@ -0,0 +1,226 @@
+package dbcache
+
+import (
+	"context"
+	"errors"
+	"shortlink-service/dbmemory"
+	"shortlink-service/dbtest"
+	"shortlink-service/shortlink"
+	"shortlink-service/shortner"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, config Config) (*Client, *dbmemory.Client) {
+	dbClient, err := dbmemory.New(context.Background(), dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+	c, err := New(dbClient, config)
+	if err != nil {
+		t.Fatalf("Error creating cache: %v", err)
+	}
+	return c, dbClient
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c, dbClient := newTestClient(t, Config{})
+
+	item := shortlink.Item{
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+		Version:   1,
+	}
+
+	t.Log("Testing negative lookups are cached...")
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(ctx, "alias"); !errors.Is(err, shortlink.ErrNotFound) {
+			t.Fatalf("expected not found error, got: %v", err)
+		}
+	}
+	if s := c.Stats(); s.Misses != 1 || s.NegativeHits != 1 {
+		t.Errorf("stats mismatch: %+v", s)
+	}
+
+	t.Log("Testing set invalidates a negative lookup...")
+	if err := c.Set(ctx, "alias", &item); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(ctx, "alias"); err != nil {
+			t.Fatalf("error getting item: %v", err)
+		}
+	}
+	if s := c.Stats(); s.Misses != 2 || s.Hits != 1 {
+		t.Errorf("stats mismatch: %+v", s)
+	}
+
+	t.Log("Testing visits update the cached item...")
+	if err := c.IncVisits(ctx, "alias"); err != nil {
+		t.Fatalf("error incrementing visits: %v", err)
+	}
+	got, err := c.Get(ctx, "alias")
+	if err != nil {
+		t.Fatalf("error getting item: %v", err)
+	}
+	if got.Visits != 1 {
+		t.Errorf("visits mismatch. expected: %d, got: %d", 1, got.Visits)
+	}
+	got.Visits = 100
+	if got, _ := c.Get(ctx, "alias"); got.Visits != 1 {
+		t.Errorf("cached item was changed through a returned item: %+v", got)
+	}
+	if err := c.AddVisits(ctx, map[string]int{"alias": 2}); err != nil {
+		t.Fatalf("error adding visits: %v", err)
+	}
+	if got, _ := c.Get(ctx, "alias"); got.Visits != 3 {
+		t.Errorf("visits mismatch. expected: %d, got: %d", 3, got.Visits)
+	}
+
+	t.Log("Testing writes invalidate the item...")
+	update := &shortlink.Item{Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://youtube.com"}}}
+	if err := c.Update(ctx, "alias", update, 1); err != nil {
+		t.Fatalf("error updating item: %v", err)
+	}
+	if got, err := c.Get(ctx, "alias"); err != nil || got.Redirects[0].URL != "https://youtube.com" {
+		t.Errorf("expected updated item, got: %+v (%v)", got, err)
+	}
+	if err := c.Delete(ctx, "alias"); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	if _, err := c.Get(ctx, "alias"); !errors.Is(err, shortlink.ErrDeleted) {
+		t.Errorf("expected deleted error, got: %v", err)
+	}
+	if err := c.Restore(ctx, "alias"); err != nil {
+		t.Fatalf("error restoring item: %v", err)
+	}
+	if _, err := c.Get(ctx, "alias"); err != nil {
+		t.Errorf("error getting restored item: %v", err)
+	}
+
+	t.Log("Testing created ids invalidate negative lookups...")
+	if _, err := c.Get(ctx, "1"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	if _, err := c.CreateGetID(ctx, &item); err != nil {
+		t.Fatalf("error creating key: %v", err)
+	}
+	if _, err := c.Get(ctx, "1"); err != nil {
+		t.Errorf("error getting created item: %v", err)
+	}
+
+	t.Log("Testing changes behind the cache show up after the ttl...")
+	c, dbClient = newTestClient(t, Config{TTL: 50 * time.Millisecond, NegativeTTL: 50 * time.Millisecond})
+	if err := c.Set(ctx, "alias", &item); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	if _, err := c.Get(ctx, "alias"); err != nil {
+		t.Fatalf("error getting item: %v", err)
+	}
+	if err := dbClient.Delete(ctx, "alias"); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	if _, err := c.Get(ctx, "alias"); err != nil {
+		t.Errorf("expected cached item, got: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.Get(ctx, "alias"); !errors.Is(err, shortlink.ErrDeleted) {
+		t.Errorf("expected deleted error after ttl, got: %v", err)
+	}
+}
+
+func TestClient_Eviction(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t, Config{Size: 2})
+
+	item := shortlink.Item{
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Set(ctx, key, &item); err != nil {
+			t.Fatalf("error setting item: %v", err)
+		}
+	}
+
+	// a is evicted by c, as b was used after a
+	for _, key := range []string{"a", "b", "c", "b", "a"} {
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Fatalf("error getting item: %v", err)
+		}
+	}
+	s := c.Stats()
+	if s.Size != 2 || s.Hits != 1 || s.Misses != 4 {
+		t.Errorf("stats mismatch: %+v", s)
+	}
+}
+
+func TestClient_InvalidConfig(t *testing.T) {
+	dbClient, err := dbmemory.New(context.Background(), dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+	for _, config := range []Config{{Size: -1}, {TTL: -time.Second}, {NegativeTTL: -time.Second}} {
+		if _, err := New(dbClient, config); err == nil {
+			t.Errorf("expected an error for config %+v", config)
+		}
+	}
+}
+
+// failingVisits doesn't add the visits of failKey.
+type failingVisits struct {
+	shortner.DbClient
+	failKey string
+}
+
+func (f *failingVisits) AddVisits(ctx context.Context, visits map[string]int) error {
+	applied := make(map[string]int)
+	for key, n := range visits {
+		if key != f.failKey {
+			applied[key] = n
+		}
+	}
+	err := f.DbClient.AddVisits(ctx, applied)
+	if err != nil {
+		return err
+	}
+	return &shortlink.VisitsError{Keys: []string{f.failKey}, Err: errors.New("storage unavailable")}
+}
+
+func TestClient_FailedVisits(t *testing.T) {
+	ctx := context.Background()
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+	c, err := New(&failingVisits{DbClient: dbClient, failKey: "b"}, Config{})
+	if err != nil {
+		t.Fatalf("Error creating cache: %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		item := &shortlink.Item{Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}}}
+		if err := c.Set(ctx, key, item); err != nil {
+			t.Fatalf("error setting item: %v", err)
+		}
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Fatalf("error getting item: %v", err)
+		}
+	}
+
+	err = c.AddVisits(ctx, map[string]int{"a": 2, "b": 3})
+	var visitsErr *shortlink.VisitsError
+	if !errors.As(err, &visitsErr) {
+		t.Fatalf("expected visits error, got: %v", err)
+	}
+	for key, want := range map[string]int{"a": 2, "b": 0} {
+		if got, err := c.Get(ctx, key); err != nil || got.Visits != want {
+			t.Errorf("cached visits of %s mismatch. expected: %d, got: %+v (%v)", key, want, got, err)
+		}
+	}
+}
+
+func TestClient_Conformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) shortner.DbClient {
+		c, _ := newTestClient(t, Config{})
+		return c
+	})
+}
@@ -2,84 +2,359 @@ package dbmemory
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"github.com/google/btree"
 	"shortlink-service/shortlink"
 	"strconv"
 	"sync"
+	"time"
 )
 
+const (
+	defaultSnapshotInterval = 5 * time.Minute
+	keysDegree              = 32
+)
+
+type Config struct {
+	// Dir makes the storage durable, every change is appended to a log in
+	// the directory and replayed on New. Memory only if empty.
+	Dir string
+	// SnapshotInterval is how often the storage is snapshotted and the log
+	// compacted, 5 minutes if zero.
+	SnapshotInterval time.Duration
+	// SyncWrites fsyncs the log on every change. Otherwise the changes are
+	// handed to the OS only, and the ones it did not write back yet (up to
+	// about 30 seconds on Linux) are lost if the machine crashes.
+	SyncWrites bool
+}
+
 type Client struct {
 	lastKeyID uint64
-	sync.Mutex
-	storage   map[string]*shortlink.Item
+	sync.RWMutex
+	storage map[string]*shortlink.Item
+	// keys orders the keys of storage, for List
+	keys      *btree.BTree
+	revisions map[string][]*shortlink.Revision
+	dir       string
+	log       logWriter
+	// logSize is the size of the complete entries in log
+	logSize    int64
+	syncWrites bool
+	// logErr is set if a failed write could not be cut off the log, no
+	// entries may follow it
+	logErr error
+	// snapshotMu serializes snapshots, they run without the storage lock
+	snapshotMu sync.Mutex
 }
 
-func New(ctx context.Context) (*Client, error) {
+func New(ctx context.Context, config Config) (*Client, error) {
 	var lastKeyID uint64 = 0
 	storage := make(map[string]*shortlink.Item)
-	c := Client{lastKeyID: lastKeyID, storage: storage}
+	c := Client{
+		lastKeyID:  lastKeyID,
+		storage:    storage,
+		keys:       btree.New(keysDegree),
+		revisions:  make(map[string][]*shortlink.Revision),
+		syncWrites: config.SyncWrites,
+	}
+	if config.Dir == "" {
+		return &c, nil
+	}
+
+	err := c.open(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	interval := config.SnapshotInterval
+	if interval == 0 {
+		interval = defaultSnapshotInterval
+	}
+	c.startSnapshots(ctx, interval)
 	return &c, nil
 }
 
 func (c *Client) Get(ctx context.Context, key string) (*shortlink.Item, error) {
-	if item, ok := c.storage[key]; ok {
-		return item, nil
+	c.RLock()
+	defer c.RUnlock()
+	item, err := c.getActive(key)
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("item with key %s is not exist", key)
+	res := *item
+	return &res, nil
 }
 
 func (c *Client) Set(ctx context.Context, key string, data *shortlink.Item) error {
+	c.Lock()
+	defer c.Unlock()
 	if _, ok := c.storage[key]; ok {
-		return errors.New("key already exist")
+		return fmt.Errorf("%w: %s", shortlink.ErrKeyExists, key)
+	}
+	return c.commit(logEntry{Op: opPut, Key: key, Item: newItem(data)})
+}
+
+func (c *Client) Update(ctx context.Context, key string, data *shortlink.Item, version int) error {
+	c.Lock()
+	defer c.Unlock()
+	item, err := c.getActive(key)
+	if err != nil {
+		return err
+	}
+	if item.Version != version {
+		return fmt.Errorf("%w: item with key %s is at version %d", shortlink.ErrVersionConflict, key, item.Version)
+	}
+	updated := *item
+	updated.Redirects = data.Redirects
+	updated.Timezone = data.Timezone
+	updated.ExpiresAt = data.ExpiresAt
+	updated.UpdatedAt = data.UpdatedAt
+	updated.Version++
+	return c.commit(logEntry{Op: opPut, Key: key, Item: &updated})
+}
+
+func (c *Client) AddRevision(ctx context.Context, rev *shortlink.Revision) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.hasRevision(rev.Key, rev.Version) {
+		return fmt.Errorf("%w: revision %d of %s", shortlink.ErrKeyExists, rev.Version, rev.Key)
 	}
-	c.storage[key] = data
-	return nil
+	r := *rev
+	return c.commit(logEntry{Op: opRevision, Key: rev.Key, Revision: &r})
+}
+
+func (c *Client) ListRevisions(ctx context.Context, key string) ([]*shortlink.Revision, error) {
+	c.RLock()
+	defer c.RUnlock()
+	revs := make([]*shortlink.Revision, len(c.revisions[key]))
+	copy(revs, c.revisions[key])
+	return revs, nil
 }
 
 func (c *Client) CreateGetID(ctx context.Context, data *shortlink.Item) (uint64, error) {
 	c.Lock()
 	defer c.Unlock()
-	c.lastKeyID++
-	idKey := strconv.FormatUint(c.lastKeyID, 10)
-	c.storage[idKey] = data
-	return c.lastKeyID, nil
+	id := c.lastKeyID + 1
+	idKey := strconv.FormatUint(id, 10)
+	err := c.commit(logEntry{Op: opPut, Key: idKey, Item: newItem(data), LastKeyID: id})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
 }
 
+func (c *Client) Import(ctx context.Context, key string, data *shortlink.Item) error {
+	c.Lock()
+	defer c.Unlock()
+	item := *data
+	e := logEntry{Op: opPut, Key: key, Item: &item}
+	if id, ok := shortlink.StandardID(key, data); ok {
+		e.LastKeyID = id
+	}
+	// the remove drops the revisions of the replaced item
+	return c.commit(logEntry{Op: opRemove, Key: key}, e)
+}
+
+// Delete soft deletes the item, it is kept until purged.
 func (c *Client) Delete(ctx context.Context, key string) error {
-	_, ok := c.storage[key]
-	if ok {
-		delete(c.storage, key)
+	c.Lock()
+	defer c.Unlock()
+	item, ok := c.storage[key]
+	if !ok || item.State == shortlink.StateDeleted {
+		return nil
+	}
+	deleted := *item
+	now := time.Now().UTC()
+	deleted.State = shortlink.StateDeleted
+	deleted.DeletedAt = &now
+	return c.commit(logEntry{Op: opPut, Key: key, Item: &deleted})
+}
+
+func (c *Client) ListDeleted(ctx context.Context, after string, limit int) ([]*shortlink.Item, error) {
+	return c.list(after, limit, shortlink.StateDeleted), nil
+}
+
+func (c *Client) Restore(ctx context.Context, key string) error {
+	c.Lock()
+	defer c.Unlock()
+	item, ok := c.storage[key]
+	if !ok || item.State != shortlink.StateDeleted {
+		return fmt.Errorf("%w: deleted item %s", shortlink.ErrNotFound, key)
+	}
+	restored := *item
+	restored.State = shortlink.StateActive
+	restored.DeletedAt = nil
+	return c.commit(logEntry{Op: opPut, Key: key, Item: &restored})
+}
+
+// Purge removes the items deleted before the given time, with their revisions.
+func (c *Client) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+	var purged int
+	for key, item := range c.storage {
+		if item.State == shortlink.StateDeleted && (item.DeletedAt == nil || item.DeletedAt.Before(deletedBefore)) {
+			err := c.commit(logEntry{Op: opRemove, Key: key})
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
 	}
-	return nil
+	return purged, nil
+}
+
+func (c *Client) Remove(ctx context.Context, key string) error {
+	c.Lock()
+	defer c.Unlock()
+	return c.commit(logEntry{Op: opRemove, Key: key})
 }
 
 func (c *Client) IncVisits(ctx context.Context, key string) error {
 	c.Lock()
 	defer c.Unlock()
-	if item, ok := c.storage[key]; ok {
-		item.Visits++
+	item, err := c.getActive(key)
+	if err != nil {
+		return err
 	}
-	return nil
+	updated := *item
+	updated.Visits++
+	return c.commit(logEntry{Op: opPut, Key: key, Item: &updated})
+}
+
+func (c *Client) AddVisits(ctx context.Context, visits map[string]int) error {
+	c.Lock()
+	defer c.Unlock()
+	var entries []logEntry
+	for key, n := range visits {
+		item, err := c.getActive(key)
+		if err != nil {
+			continue
+		}
+		updated := *item
+		updated.Visits += n
+		entries = append(entries, logEntry{Op: opPut, Key: key, Item: &updated})
+	}
+	return c.commit(entries...)
 }
 
 func (c *Client) GetVisits(ctx context.Context, key string) (int, error) {
+	c.RLock()
+	defer c.RUnlock()
 	if item, ok := c.storage[key]; ok {
 		return item.Visits, nil
 	}
-	return 0, errors.New("key is not exist")
+	return 0, fmt.Errorf("%w: %s", shortlink.ErrNotFound, key)
+}
+
+func (c *Client) List(ctx context.Context, after string, limit int) ([]*shortlink.Item, error) {
+	return c.list(after, limit, shortlink.StateActive), nil
+}
+
+// list returns up to limit items in the state with a key greater than after.
+func (c *Client) list(after string, limit int, state shortlink.State) []*shortlink.Item {
+	c.RLock()
+	defer c.RUnlock()
+	var items []*shortlink.Item
+
+	c.keys.AscendGreaterOrEqual(keyItem(after), func(i btree.Item) bool {
+		if len(items) >= limit {
+			return false
+		}
+		key := string(i.(keyItem))
+		if item := c.storage[key]; key != after && item.State == state {
+			items = append(items, itemWithKey(key, item))
+		}
+		return true
+	})
+
+	return items
 }
 
-func (c *Client) AsArray(ctx context.Context) ([]*shortlink.Item, error) {
+func (c *Client) Query(ctx context.Context, q *shortlink.Query) (*shortlink.QueryResult, error) {
+	c.RLock()
 	var items []*shortlink.Item
+	for key, item := range c.storage {
+		if q.Match(item) {
+			items = append(items, itemWithKey(key, item))
+		}
+	}
+	c.RUnlock()
+
+	q.Sort(items)
+	return &shortlink.QueryResult{Items: q.Page(items), Total: len(items)}, nil
+}
+
+// keyItem is a key in the keys tree.
+type keyItem string
 
+func (k keyItem) Less(than btree.Item) bool {
+	return k < than.(keyItem)
+}
+
+// PurgeExpired removes all items that are expired at the given time and
+// returns the number of removed items.
+func (c *Client) PurgeExpired(ctx context.Context, now time.Time) int {
+	c.Lock()
+	defer c.Unlock()
+	var purged int
 	for key, item := range c.storage {
-		items = append(items, &shortlink.Item{
-			Key:       key,
-			Redirects: item.Redirects,
-			Visits:    item.Visits,
-		})
+		if item.Expired(now) {
+			err := c.commit(logEntry{Op: opRemove, Key: key})
+			if err != nil {
+				fmt.Printf("error purging expired item %s: %v\n", key, err)
+				return purged
+			}
+			purged++
+		}
 	}
+	return purged
+}
+
+// StartSweeper purges the items expired longer than retention ago every
+// interval until ctx is done. Until then expired items respond 410 Gone.
+func (c *Client) StartSweeper(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				c.PurgeExpired(ctx, now.Add(-retention))
+			}
+		}
+	}()
+}
+
+func (c *Client) getActive(key string) (*shortlink.Item, error) {
+	item, ok := c.storage[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", shortlink.ErrNotFound, key)
+	}
+	if item.State == shortlink.StateDeleted {
+		return nil, fmt.Errorf("%w: %s", shortlink.ErrDeleted, key)
+	}
+	return item, nil
+}
+
+func (c *Client) hasRevision(key string, version int) bool {
+	for _, r := range c.revisions[key] {
+		if r.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func newItem(data *shortlink.Item) *shortlink.Item {
+	item := *data
+	item.State = shortlink.StateActive
+	return &item
+}
 
-	return items, nil
+func itemWithKey(key string, item *shortlink.Item) *shortlink.Item {
+	res := *item
+	res.Key = key
+	return &res
 }
@@ -2,15 +2,22 @@ package dbmemory
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"shortlink-service/dbtest"
 	"shortlink-service/shortlink"
+	"shortlink-service/shortner"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
 
 func TestClient(t *testing.T) {
 	ctx := context.Background()
-	c, err := New(ctx)
+	c, err := New(ctx, Config{})
 	if err != nil {
 		t.Fatalf("Error creating dbClient: %v", err)
 	}
@@ -24,8 +31,11 @@ func TestClient(t *testing.T) {
 
 	t.Log("Testing key concurrent increments...")
 	count := 100000
+	var wg sync.WaitGroup
 	for i := 0; i < count; i++ {
+		wg.Add(1)
 		go func(item *shortlink.Item) {
+			defer wg.Done()
 			_, err := c.CreateGetID(ctx, item)
 			if err != nil {
 				t.Errorf("Error: %v", err)
@@ -33,7 +43,7 @@ func TestClient(t *testing.T) {
 			}
 		}(&shortlinkItem)
 	}
-	time.Sleep(time.Second)
+	wg.Wait()
 	if c.lastKeyID != uint64(count) {
 		t.Error("mismatch key count")
 	}
@@ -61,15 +71,17 @@ func TestClient(t *testing.T) {
 	}
 	visKey := strconv.FormatUint(visKeyId, 10)
 	for i := 0; i < visCount; i++ {
+		wg.Add(1)
 		go func(k string) {
-			err = c.IncVisits(ctx, k)
+			defer wg.Done()
+			err := c.IncVisits(ctx, k)
 			if err != nil {
 				t.Errorf("Error: %v", err)
 				return
 			}
 		}(visKey)
 	}
-	time.Sleep(time.Second)
+	wg.Wait()
 	v, err := c.GetVisits(ctx, visKey)
 	if err != nil {
 		t.Fatalf("error get key vists: %v", err)
@@ -79,3 +91,337 @@ func TestClient(t *testing.T) {
 	}
 	t.Logf("visits: %d", v)
 }
+
+func TestClient_PurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(ctx, Config{})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Minute)
+	expiring := shortlink.Item{
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+		ExpiresAt: &expiresAt,
+	}
+	lasting := shortlink.Item{
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	}
+	expiringID, err := c.CreateGetID(ctx, &expiring)
+	if err != nil {
+		t.Fatalf("error creating key: %v", err)
+	}
+	lastingID, err := c.CreateGetID(ctx, &lasting)
+	if err != nil {
+		t.Fatalf("error creating key: %v", err)
+	}
+
+	if n := c.PurgeExpired(ctx, time.Now()); n != 0 {
+		t.Errorf("purged %d items before expiry", n)
+	}
+	if n := c.PurgeExpired(ctx, expiresAt); n != 1 {
+		t.Errorf("purged items mismatch. expected: %d, got: %d", 1, n)
+	}
+	if _, err := c.Get(ctx, strconv.FormatUint(expiringID, 10)); err == nil {
+		t.Error("expired item was not purged")
+	}
+	if _, err := c.Get(ctx, strconv.FormatUint(lastingID, 10)); err != nil {
+		t.Errorf("item without expiry was purged: %v", err)
+	}
+}
+
+func TestClient_SweeperRetention(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := New(ctx, Config{})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+
+	for key, expired := range map[string]time.Duration{"recent": time.Minute, "old": 2 * time.Hour} {
+		expiresAt := time.Now().Add(-expired)
+		item := shortlink.Item{
+			Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+			ExpiresAt: &expiresAt,
+		}
+		if err := c.Set(ctx, key, &item); err != nil {
+			t.Fatalf("error setting item: %v", err)
+		}
+	}
+
+	c.StartSweeper(ctx, 10*time.Millisecond, time.Hour)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := c.Get(ctx, "old"); err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := c.Get(ctx, "old"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("expected the item expired before the retention to be purged, got: %v", err)
+	}
+	if _, err := c.Get(ctx, "recent"); err != nil {
+		t.Errorf("item expired within the retention was purged: %v", err)
+	}
+}
+
+func TestClient_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(ctx, Config{})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+
+	item := shortlink.Item{
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	}
+
+	t.Log("Testing concurrent reads and writes...")
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", i)
+			if err := c.Set(ctx, key, &item); err != nil {
+				t.Errorf("Error: %v", err)
+				return
+			}
+			for j := 0; j < 10; j++ {
+				if err := c.IncVisits(ctx, key); err != nil {
+					t.Errorf("Error: %v", err)
+				}
+				if _, err := c.Get(ctx, key); err != nil {
+					t.Errorf("Error: %v", err)
+				}
+				if _, err := c.List(ctx, "", 100); err != nil {
+					t.Errorf("Error: %v", err)
+				}
+			}
+			if err := c.Delete(ctx, key); err != nil {
+				t.Errorf("Error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	deleted, err := c.ListDeleted(ctx, "", 100)
+	if err != nil {
+		t.Fatalf("error listing deleted items: %v", err)
+	}
+	if len(deleted) != 50 {
+		t.Errorf("deleted items mismatch. expected: %d, got: %d", 50, len(deleted))
+	}
+	for _, d := range deleted {
+		if d.Visits != 10 {
+			t.Errorf("visits of %s mismatch. expected: %d, got: %d", d.Key, 10, d.Visits)
+		}
+	}
+}
+
+func TestClient_Persistence(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c, err := New(ctx, Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+
+	item := shortlink.Item{
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+		Version:   1,
+	}
+	id, err := c.CreateGetID(ctx, &item)
+	if err != nil {
+		t.Fatalf("error creating key: %v", err)
+	}
+	idKey := strconv.FormatUint(id, 10)
+	if err := c.Set(ctx, "alias", &item); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	if err := c.IncVisits(ctx, idKey); err != nil {
+		t.Fatalf("error incrementing visits: %v", err)
+	}
+	err = c.AddRevision(ctx, &shortlink.Revision{Key: idKey, Version: 1, Redirects: item.Redirects})
+	if err != nil {
+		t.Fatalf("error adding revision: %v", err)
+	}
+
+	t.Log("Testing log replay...")
+	check := func(c *Client, lastKeyID uint64) {
+		t.Helper()
+		got, err := c.Get(ctx, idKey)
+		if err != nil {
+			t.Fatalf("error getting replayed item: %v", err)
+		}
+		if got.Visits != 1 || got.Redirects[0].URL != "https://google.com" {
+			t.Errorf("replayed item mismatch: %+v", got)
+		}
+		if _, err := c.Get(ctx, "alias"); err != nil {
+			t.Errorf("error getting replayed item: %v", err)
+		}
+		revs, err := c.ListRevisions(ctx, idKey)
+		if err != nil || len(revs) != 1 {
+			t.Errorf("replayed revisions mismatch: %v (%v)", revs, err)
+		}
+		if c.lastKeyID != lastKeyID {
+			t.Errorf("last key id mismatch. expected: %d, got: %d", lastKeyID, c.lastKeyID)
+		}
+	}
+	replayed, err := New(ctx, Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("Error replaying dbClient: %v", err)
+	}
+	check(replayed, id)
+
+	t.Log("Testing snapshot and log after it...")
+	if err := c.Snapshot(); err != nil {
+		t.Fatalf("error snapshotting: %v", err)
+	}
+	if err := c.Delete(ctx, "alias"); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	if _, err := c.Purge(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("error purging items: %v", err)
+	}
+	nextID, err := c.CreateGetID(ctx, &item)
+	if err != nil {
+		t.Fatalf("error creating key: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("error closing dbClient: %v", err)
+	}
+
+	t.Log("Testing a cut off log entry is dropped...")
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("error opening log: %v", err)
+	}
+	f.WriteString(`{"op":"put","key":"partial"`)
+	f.Close()
+
+	replayed, err = New(ctx, Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("Error replaying dbClient: %v", err)
+	}
+	if _, err := replayed.Get(ctx, "alias"); err == nil {
+		t.Error("purged item was replayed")
+	}
+	if _, err := replayed.Get(ctx, strconv.FormatUint(nextID, 10)); err != nil {
+		t.Errorf("error getting item created after snapshot: %v", err)
+	}
+	if replayed.lastKeyID != nextID {
+		t.Errorf("last key id mismatch. expected: %d, got: %d", nextID, replayed.lastKeyID)
+	}
+	items, err := replayed.List(ctx, "", 10)
+	if err != nil || len(items) != 2 || items[0].Key != idKey || items[1].Key != strconv.FormatUint(nextID, 10) {
+		t.Errorf("replayed list mismatch: %v (%v)", items, err)
+	}
+}
+
+// failingLog writes half of every write to the log and fails.
+type failingLog struct {
+	logWriter
+}
+
+func (l failingLog) Write(p []byte) (int, error) {
+	n, _ := l.logWriter.Write(p[:len(p)/2])
+	return n, errors.New("disk full")
+}
+
+func TestClient_PersistenceFailures(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c, err := New(ctx, Config{Dir: dir, SyncWrites: true})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+	item := shortlink.Item{
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+		Version:   1,
+	}
+
+	t.Log("Testing a failed write is cut off the log...")
+	if err := c.Set(ctx, "before", &item); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	log := c.log
+	c.log = failingLog{log}
+	if err := c.Set(ctx, "failed", &item); err == nil {
+		t.Error("expected an error for a failed write")
+	}
+	if _, err := c.Get(ctx, "failed"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("item of a failed write was stored: %v", err)
+	}
+	c.log = log
+	if err := c.Set(ctx, "after", &item); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	replayed, err := New(ctx, Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("Error replaying dbClient: %v", err)
+	}
+	if _, err := replayed.Get(ctx, "after"); err != nil {
+		t.Errorf("error getting item written after a failed write: %v", err)
+	}
+
+	t.Log("Testing a snapshot keeps the entries written during it...")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := c.Set(ctx, fmt.Sprintf("key-%d-%d", i, j), &item); err != nil {
+					t.Errorf("Error: %v", err)
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 5; i++ {
+		if err := c.Snapshot(); err != nil {
+			t.Errorf("error snapshotting: %v", err)
+		}
+	}
+	wg.Wait()
+	// closing would snapshot everything, replay what is on disk instead
+	c.Lock()
+	c.log.Close()
+	c.log = nil
+	c.Unlock()
+
+	replayed, err = New(ctx, Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("Error replaying dbClient: %v", err)
+	}
+	for _, key := range []string{"before", "after", "key-0-0", "key-3-49"} {
+		if _, err := replayed.Get(ctx, key); err != nil {
+			t.Errorf("error getting replayed item %s: %v", key, err)
+		}
+	}
+	items, err := replayed.List(ctx, "", 1000)
+	if err != nil || len(items) != 202 {
+		t.Errorf("replayed items mismatch. expected: %d, got: %d (%v)", 202, len(items), err)
+	}
+}
+
+func TestClient_Conformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) shortner.DbClient {
+		c, err := New(context.Background(), Config{})
+		if err != nil {
+			t.Fatalf("Error creating dbClient: %v", err)
+		}
+		return c
+	})
+}
+
+func TestClient_ConformancePersistent(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) shortner.DbClient {
+		c, err := New(context.Background(), Config{Dir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("Error creating dbClient: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	})
+}
@@ -0,0 +1,346 @@
+package dbmemory
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"shortlink-service/shortlink"
+	"sort"
+	"time"
+)
+
+const (
+	logFile      = "shortlinks.log"
+	snapshotFile = "shortlinks.snapshot"
+
+	opPut      = "put"
+	opRemove   = "remove"
+	opRevision = "revision"
+)
+
+// logEntry is a change of the storage. Entries hold the resulting state
+// rather than the operation, so replaying an entry twice is harmless.
+type logEntry struct {
+	Op        string              `json:"op"`
+	Key       string              `json:"key"`
+	Item      *shortlink.Item     `json:"item,omitempty"`
+	Revision  *shortlink.Revision `json:"revision,omitempty"`
+	LastKeyID uint64              `json:"lastKeyId,omitempty"`
+}
+
+// logWriter is the log file, tests replace it to make writes fail.
+type logWriter interface {
+	io.Writer
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+	Truncate(size int64) error
+	Sync() error
+}
+
+type snapshot struct {
+	LastKeyID uint64                           `json:"lastKeyId"`
+	Items     map[string]*shortlink.Item       `json:"items"`
+	Revisions map[string][]*shortlink.Revision `json:"revisions"`
+}
+
+// commit appends the entries to the log, when persistence is enabled, and
+// applies them. The caller must hold the write lock.
+func (c *Client) commit(entries ...logEntry) error {
+	if c.log != nil && len(entries) > 0 {
+		var buf []byte
+		for _, e := range entries {
+			line, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			buf = append(append(buf, line...), '\n')
+		}
+		err := c.write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range entries {
+		c.apply(e)
+	}
+	return nil
+}
+
+// write appends buf to the log. A failed write is cut off again, as the
+// entries after a partial one could not be replayed.
+func (c *Client) write(buf []byte) error {
+	if c.logErr != nil {
+		return fmt.Errorf("log is broken: %w", c.logErr)
+	}
+	_, err := c.log.Write(buf)
+	if err == nil && c.syncWrites {
+		err = c.log.Sync()
+	}
+	if err != nil {
+		truncErr := c.truncateLog(c.logSize)
+		if truncErr != nil {
+			c.logErr = truncErr
+		}
+		return fmt.Errorf("failed to write log: %w", err)
+	}
+	c.logSize += int64(len(buf))
+	return nil
+}
+
+func (c *Client) truncateLog(size int64) error {
+	err := c.log.Truncate(size)
+	if err == nil {
+		_, err = c.log.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		return err
+	}
+	c.logSize = size
+	return nil
+}
+
+func (c *Client) apply(e logEntry) {
+	switch e.Op {
+	case opPut:
+		if _, ok := c.storage[e.Key]; !ok {
+			c.keys.ReplaceOrInsert(keyItem(e.Key))
+		}
+		c.storage[e.Key] = e.Item
+		if e.LastKeyID > c.lastKeyID {
+			c.lastKeyID = e.LastKeyID
+		}
+	case opRemove:
+		if _, ok := c.storage[e.Key]; ok {
+			c.keys.Delete(keyItem(e.Key))
+		}
+		delete(c.storage, e.Key)
+		delete(c.revisions, e.Key)
+	case opRevision:
+		if c.hasRevision(e.Key, e.Revision.Version) {
+			return
+		}
+		// a new slice, snapshots may be reading the current one
+		revs := make([]*shortlink.Revision, 0, len(c.revisions[e.Key])+1)
+		revs = append(append(revs, c.revisions[e.Key]...), e.Revision)
+		sort.Slice(revs, func(i, j int) bool {
+			return revs[i].Version < revs[j].Version
+		})
+		c.revisions[e.Key] = revs
+	}
+}
+
+// open loads the last snapshot of dir and replays the log written since,
+// then opens the log for appending.
+func (c *Client) open(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	c.dir = dir
+
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var s snapshot
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		c.lastKeyID = s.LastKeyID
+		if s.Items != nil {
+			c.storage = s.Items
+			for key := range c.storage {
+				c.keys.ReplaceOrInsert(keyItem(key))
+			}
+		}
+		if s.Revisions != nil {
+			c.revisions = s.Revisions
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	size, err := c.replay(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	// drop a last entry that was cut off by a crash
+	c.log = f
+	err = c.truncateLog(size)
+	if err != nil {
+		c.log = nil
+		f.Close()
+		return err
+	}
+	return nil
+}
+
+// replay applies the complete entries of the log and returns their size.
+func (c *Client) replay(r io.Reader) (int64, error) {
+	var size int64
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		var e logEntry
+		err = json.Unmarshal(line, &e)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read log at offset %d: %w", size, err)
+		}
+		c.apply(e)
+		size += int64(len(line))
+	}
+}
+
+// Snapshot writes the whole storage to the snapshot file and drops the
+// entries it holds from the log. The storage is only locked to copy it and to
+// compact the log, so it keeps serving while the snapshot is written. It is a
+// no-op when persistence is disabled.
+func (c *Client) Snapshot() error {
+	c.snapshotMu.Lock()
+	defer c.snapshotMu.Unlock()
+
+	c.RLock()
+	if c.log == nil {
+		c.RUnlock()
+		return nil
+	}
+	// the items and revision lists are replaced rather than changed, so
+	// copies of the maps are enough
+	s := snapshot{
+		LastKeyID: c.lastKeyID,
+		Items:     make(map[string]*shortlink.Item, len(c.storage)),
+		Revisions: make(map[string][]*shortlink.Revision, len(c.revisions)),
+	}
+	for key, item := range c.storage {
+		s.Items[key] = item
+	}
+	for key, revs := range c.revisions {
+		s.Revisions[key] = revs
+	}
+	covered := c.logSize
+	c.RUnlock()
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	err = writeFile(filepath.Join(c.dir, snapshotFile), data)
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	return c.compactLog(covered)
+}
+
+// compactLog drops the first covered bytes of the log, the entries held by
+// the snapshot. A crash before it replays them over the snapshot, which is
+// safe as the entries are idempotent. The caller must hold the write lock.
+func (c *Client) compactLog(covered int64) error {
+	if c.log == nil || c.logErr != nil {
+		return nil
+	}
+	if covered == c.logSize {
+		return c.truncateLog(0)
+	}
+
+	// move the entries written during the snapshot to a new log
+	tail := make([]byte, c.logSize-covered)
+	_, err := c.log.ReadAt(tail, covered)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(c.dir, logFile)
+	f, err := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(tail)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	c.log.Close()
+	c.log = f
+	c.logSize = int64(len(tail))
+	return nil
+}
+
+// writeFile replaces the file at path with data, through a synced temporary
+// file so a crash leaves either the old or the new content.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Close snapshots the storage and closes the log.
+func (c *Client) Close() error {
+	err := c.Snapshot()
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.log == nil {
+		return nil
+	}
+	err = c.log.Close()
+	c.log = nil
+	return err
+}
+
+func (c *Client) startSnapshots(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := c.Snapshot()
+				if err != nil {
+					fmt.Printf("error snapshotting storage: %v\n", err)
+				}
+			}
+		}
+	}()
+}
@@ -2,34 +2,55 @@ package dbmongo
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"shortlink-service/shortlink"
 	"strconv"
+	"strings"
+	"time"
 )
 
-type DocState int
-
-const (
-	docStateSoftDelete DocState = 0
-	docStateActive     DocState = 1
-)
+// backfillBatchSize is the number of documents a backfill updates at once.
+const backfillBatchSize = 1000
 
 type Config struct {
 	URI           string
 	DbName        string
 	ItemsCollName string
+	// IDBlockSize is the number of standard IDs an instance reserves from
+	// the counter at once, 100 if zero. Larger blocks mean fewer counter
+	// updates, but bigger gaps in the IDs of restarted instances.
+	IDBlockSize int
+	// ExpiredRetention is how long expired items are kept before the TTL
+	// index removes them, until then they respond 410 Gone rather than 404.
+	ExpiredRetention time.Duration
 }
 
 type Client struct {
 	mongoClient *mongo.Client
 	items       *mongo.Collection
 	counters    *mongo.Collection
+	revisions   *mongo.Collection
+	ids         *idAllocator
 }
 
 func New(ctx context.Context, config Config) (*Client, error) {
+	blockSize := config.IDBlockSize
+	if blockSize == 0 {
+		blockSize = defaultIDBlockSize
+	}
+	if blockSize < 0 {
+		return nil, errors.New("id block size must be positive")
+	}
+	if config.ExpiredRetention < 0 {
+		return nil, errors.New("expired retention must not be negative")
+	}
+
 	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(config.URI))
 	if err != nil {
 		return nil, err
@@ -42,6 +63,21 @@ func New(ctx context.Context, config Config) (*Client, error) {
 		mongoClient: mongoClient,
 		items:       mongoClient.Database(config.DbName).Collection(config.ItemsCollName),
 		counters:    mongoClient.Database(config.DbName).Collection("counters"),
+		revisions:   mongoClient.Database(config.DbName).Collection("revisions"),
+	}
+	c.ids = &idAllocator{
+		size: uint64(blockSize),
+		reserve: func(ctx context.Context, n uint64) (uint64, error) {
+			return c.reserveSeq(ctx, "shortlinkId", n)
+		},
+	}
+	err = c.ensureIndexes(ctx, config.ExpiredRetention)
+	if err != nil {
+		return nil, err
+	}
+	err = c.backfill(ctx)
+	if err != nil {
+		return nil, err
 	}
 	return &c, nil
 }
@@ -50,51 +86,152 @@ func (c *Client) Get(ctx context.Context, key string) (*shortlink.Item, error) {
 	var res shortlink.Item
 	filter := bson.D{{"key", key}}
 	err := c.items.FindOne(ctx, filter).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("%w: %s", shortlink.ErrNotFound, key)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if res.State == shortlink.StateDeleted {
+		return nil, fmt.Errorf("%w: %s", shortlink.ErrDeleted, key)
+	}
 	return &res, nil
 }
 
 func (c *Client) Set(ctx context.Context, key string, data *shortlink.Item) error {
-	id, err := c.getNextSeq(ctx, "shortlinkId")
+	_, err := c.items.InsertOne(ctx, itemDoc(primitive.NewObjectID(), key, data))
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", shortlink.ErrKeyExists, key)
+	}
 	if err != nil {
 		return err
 	}
-	_, err = c.items.InsertOne(ctx, bson.D{
-		{"_id", id},
-		{"key", key},
-		{"redirects", data.Redirects},
-		{"visits", data.Visits},
-		{"state", docStateActive},
-	})
+	return nil
+}
+
+func (c *Client) Update(ctx context.Context, key string, data *shortlink.Item, version int) error {
+	filter := bson.D{{"key", key}, {"state", shortlink.StateActive}, {"version", version}}
+	if version == 0 {
+		// documents written before versioning have no version field, null matches them
+		filter[2] = bson.E{"version", bson.D{{"$in", bson.A{0, nil}}}}
+	}
+	update := bson.D{
+		{"$set", bson.D{
+			{"redirects", data.Redirects},
+			{"timezone", data.Timezone},
+			{"expiresAt", data.ExpiresAt},
+			{"updatedAt", data.UpdatedAt},
+			{"domains", shortlink.Domains(data.Redirects)},
+		}},
+		{"$inc", bson.D{{"version", 1}}},
+	}
+	res, err := c.items.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
-	return nil
+	if res.MatchedCount > 0 {
+		// the revisions expire with the item
+		_, err = c.revisions.UpdateMany(ctx, bson.D{{"key", key}}, bson.D{{"$set", bson.D{{"expiresAt", data.ExpiresAt}}}})
+		return err
+	}
+
+	item, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: item with key %s is at version %d", shortlink.ErrVersionConflict, key, item.Version)
+}
+
+// AddRevision stores the revision with the expiry of its item. The TTL index
+// removes the revisions along with the expired item, so the key can be taken
+// again with a new history.
+func (c *Client) AddRevision(ctx context.Context, rev *shortlink.Revision) error {
+	var item struct {
+		ExpiresAt *time.Time `bson:"expiresAt"`
+	}
+	opts := options.FindOne().SetProjection(bson.D{{"expiresAt", 1}})
+	err := c.items.FindOne(ctx, bson.D{{"key", rev.Key}}, opts).Decode(&item)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	doc := bson.D{
+		{"key", rev.Key},
+		{"version", rev.Version},
+		{"redirects", rev.Redirects},
+		{"author", rev.Author},
+		{"createdAt", rev.CreatedAt},
+		{"expiresAt", item.ExpiresAt},
+	}
+	_, err = c.revisions.InsertOne(ctx, doc)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: revision %d of %s", shortlink.ErrKeyExists, rev.Version, rev.Key)
+	}
+	return err
+}
+
+func (c *Client) ListRevisions(ctx context.Context, key string) ([]*shortlink.Revision, error) {
+	var revs []*shortlink.Revision
+	opts := options.Find().SetSort(bson.D{{"version", 1}})
+	cur, err := c.revisions.Find(ctx, bson.D{{"key", key}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	err = cur.All(ctx, &revs)
+	if err != nil {
+		return nil, err
+	}
+	return revs, nil
 }
 
 func (c *Client) CreateGetID(ctx context.Context, data *shortlink.Item) (uint64, error) {
-	id, err := c.getNextSeq(ctx, "shortlinkId")
+	// an ID is taken if it was imported into the block of this instance after it was reserved
+	for attempt := uint64(0); attempt <= c.ids.size; attempt++ {
+		id, err := c.ids.nextID(ctx)
+		if err != nil {
+			return 0, err
+		}
+		_, err = c.items.InsertOne(ctx, itemDoc(id, strconv.FormatUint(id, 10), data))
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+	return 0, errors.New("failed to find a free id")
+}
+
+func (c *Client) Import(ctx context.Context, key string, data *shortlink.Item) error {
+	_, err := c.revisions.DeleteMany(ctx, bson.D{{"key", key}})
 	if err != nil {
-		return 0, err
+		return err
 	}
-	_, err = c.items.InsertOne(ctx, bson.D{
-		{"_id", id},
-		{"key", strconv.FormatUint(id, 10)},
-		{"redirects", data.Redirects},
-		{"visits", data.Visits},
-		{"state", docStateActive},
-	})
+	// a replaced document keeps its _id, a new one gets an ObjectID
+	doc := append(itemFields(key, data, data.State),
+		bson.E{"updatedAt", data.UpdatedAt},
+		bson.E{"deletedAt", data.DeletedAt},
+	)
+	_, err = c.items.ReplaceOne(ctx, bson.D{{"key", key}}, doc, options.Replace().SetUpsert(true))
 	if err != nil {
-		return 0, err
+		return err
 	}
-	return id, nil
+	if id, ok := shortlink.StandardID(key, data); ok {
+		c.ids.skipPast(id)
+		return c.advanceSeq(ctx, "shortlinkId", id)
+	}
+	return nil
 }
 
+// Delete soft deletes the item, it is kept until purged.
 func (c *Client) Delete(ctx context.Context, key string) error {
-	filter := bson.D{{"key", key}}
-	update := bson.D{{"$set", bson.D{{"state", docStateSoftDelete}}}}
+	filter := bson.D{{"key", key}, {"state", shortlink.StateActive}}
+	update := bson.D{{"$set", bson.D{
+		{"state", shortlink.StateDeleted},
+		{"deletedAt", time.Now().UTC()},
+	}}}
 	_, err := c.items.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
@@ -102,16 +239,154 @@ func (c *Client) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+func (c *Client) ListDeleted(ctx context.Context, after string, limit int) ([]*shortlink.Item, error) {
+	return c.list(ctx, after, limit, shortlink.StateDeleted)
+}
+
+func (c *Client) Restore(ctx context.Context, key string) error {
+	filter := bson.D{{"key", key}, {"state", shortlink.StateDeleted}}
+	update := bson.D{
+		{"$set", bson.D{{"state", shortlink.StateActive}}},
+		{"$unset", bson.D{{"deletedAt", ""}}},
+	}
+	res, err := c.items.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%w: deleted item %s", shortlink.ErrNotFound, key)
+	}
+	return nil
+}
+
+// Purge removes the items deleted before the given time, with their revisions.
+// Items deleted before deletion times were recorded are purged as well.
+func (c *Client) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	filter := bson.D{
+		{"state", shortlink.StateDeleted},
+		{"$or", bson.A{
+			bson.D{{"deletedAt", bson.D{{"$lt", deletedBefore}}}},
+			bson.D{{"deletedAt", nil}},
+		}},
+	}
+	items, err := c.find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	keys := make(bson.A, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	_, err = c.revisions.DeleteMany(ctx, bson.D{{"key", bson.D{{"$in", keys}}}})
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.items.DeleteMany(ctx, bson.D{
+		{"key", bson.D{{"$in", keys}}},
+		{"state", shortlink.StateDeleted},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+func (c *Client) Remove(ctx context.Context, key string) error {
+	_, err := c.revisions.DeleteMany(ctx, bson.D{{"key", key}})
+	if err != nil {
+		return err
+	}
+	_, err = c.items.DeleteOne(ctx, bson.D{{"key", key}})
+	return err
+}
+
 func (c *Client) IncVisits(ctx context.Context, key string) error {
-	filter := bson.D{{"key", key}}
+	filter := bson.D{{"key", key}, {"state", shortlink.StateActive}}
 	update := bson.D{{"$inc", bson.D{{"visits", 1}}}}
-	_, err := c.items.UpdateOne(ctx, filter, update)
+	res, err := c.items.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
+	if res.MatchedCount == 0 {
+		_, err := c.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", shortlink.ErrNotFound, key)
+	}
 	return nil
 }
 
+// visitsBatchSize is the number of counts AddVisits writes at once. The
+// driver splits larger bulk writes on its own, and a failure of a later
+// batch doesn't tell which ones were applied.
+const visitsBatchSize = 1000
+
+// AddVisits sends the counts in unordered bulk writes. The updates that fail
+// don't stop the others, their keys are reported in a shortlink.VisitsError.
+// Any other error of the first bulk write means that no count was added, the
+// one of a later write reports the keys of that and the following writes.
+func (c *Client) AddVisits(ctx context.Context, visits map[string]int) error {
+	if len(visits) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(visits))
+	models := make([]mongo.WriteModel, 0, len(visits))
+	for key, n := range visits {
+		keys = append(keys, key)
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{"key", key}, {"state", shortlink.StateActive}}).
+			SetUpdate(bson.D{{"$inc", bson.D{{"visits", n}}}}))
+	}
+
+	var failed []string
+	var bulkErr error
+	for start := 0; start < len(models); start += visitsBatchSize {
+		end := start + visitsBatchSize
+		if end > len(models) {
+			end = len(models)
+		}
+		_, err := c.items.BulkWrite(ctx, models[start:end], options.BulkWrite().SetOrdered(false))
+		if err == nil {
+			continue
+		}
+		batchFailed, ok := bulkWriteFailures(keys[start:end], err)
+		if !ok {
+			if start == 0 {
+				return err
+			}
+			// the counts of the previous writes were added
+			return &shortlink.VisitsError{Keys: append(failed, keys[start:]...), Err: err}
+		}
+		failed = append(failed, batchFailed...)
+		bulkErr = err
+	}
+	if bulkErr != nil {
+		return &shortlink.VisitsError{Keys: failed, Err: bulkErr}
+	}
+	return nil
+}
+
+// bulkWriteFailures returns the keys of the failed updates of a bulk write of
+// the keys, and false if err is not a mongo.BulkWriteException. A write
+// concern error alone leaves no write errors, the updates were applied on the
+// primary.
+func bulkWriteFailures(keys []string, err error) ([]string, bool) {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) {
+		return nil, false
+	}
+	failed := make([]string, 0, len(bulkErr.WriteErrors))
+	for _, writeErr := range bulkErr.WriteErrors {
+		failed = append(failed, keys[writeErr.Index])
+	}
+	return failed, true
+}
+
 func (c *Client) GetVisits(ctx context.Context, key string) (int, error) {
 	item, err := c.Get(ctx, key)
 	if err != nil {
@@ -120,9 +395,84 @@ func (c *Client) GetVisits(ctx context.Context, key string) (int, error) {
 	return item.Visits, nil
 }
 
-func (c *Client) AsArray(ctx context.Context) ([]*shortlink.Item, error) {
+func (c *Client) List(ctx context.Context, after string, limit int) ([]*shortlink.Item, error) {
+	return c.list(ctx, after, limit, shortlink.StateActive)
+}
+
+// list returns up to limit items in the state with a key greater than after.
+func (c *Client) list(ctx context.Context, after string, limit int, state shortlink.State) ([]*shortlink.Item, error) {
+	filter := bson.D{{"key", bson.D{{"$gt", after}}}, {"state", state}}
+	opts := options.Find().SetSort(bson.D{{"key", 1}}).SetLimit(int64(limit))
+	return c.find(ctx, filter, opts)
+}
+
+func (c *Client) Query(ctx context.Context, q *shortlink.Query) (*shortlink.QueryResult, error) {
+	filter := bson.D{}
+	if q.Domain != "" {
+		filter = append(filter, bson.E{"domains", strings.ToLower(q.Domain)})
+	}
+	created := bson.D{}
+	if q.CreatedFrom != nil {
+		created = append(created, bson.E{"$gte", *q.CreatedFrom})
+	}
+	if q.CreatedTo != nil {
+		created = append(created, bson.E{"$lt", *q.CreatedTo})
+	}
+	if len(created) > 0 {
+		filter = append(filter, bson.E{"createdAt", created})
+	}
+	visits := bson.D{}
+	if q.MinVisits != nil {
+		visits = append(visits, bson.E{"$gte", *q.MinVisits})
+	}
+	if q.MaxVisits != nil {
+		visits = append(visits, bson.E{"$lte", *q.MaxVisits})
+	}
+	if len(visits) > 0 {
+		filter = append(filter, bson.E{"visits", visits})
+	}
+	if q.KeyType != "" {
+		filter = append(filter, bson.E{"keyType", q.KeyType})
+	}
+	if q.State != nil {
+		filter = append(filter, bson.E{"state", *q.State})
+	}
+
+	total, err := c.items.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := 1
+	if q.Desc {
+		dir = -1
+	}
+	var sort bson.D
+	switch q.SortBy {
+	case shortlink.SortByCreatedAt:
+		sort = bson.D{{"createdAt", dir}, {"key", 1}}
+	case shortlink.SortByVisits:
+		sort = bson.D{{"visits", dir}, {"key", 1}}
+	default:
+		sort = bson.D{{"key", dir}}
+	}
+	opts := options.Find().SetSort(sort).SetSkip(int64(q.Offset))
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit))
+	}
+	items, err := c.find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []*shortlink.Item{}
+	}
+	return &shortlink.QueryResult{Items: items, Total: int(total)}, nil
+}
+
+func (c *Client) find(ctx context.Context, filter bson.D, opts ...*options.FindOptions) ([]*shortlink.Item, error) {
 	var items []*shortlink.Item
-	cur, err := c.items.Find(ctx, bson.D{{"state", docStateActive}})
+	cur, err := c.items.Find(ctx, filter, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -150,13 +500,16 @@ func (c *Client) Disconnect(ctx context.Context) error {
 	return nil
 }
 
-func (c *Client) getNextSeq(ctx context.Context, name string) (uint64, error) {
+// reserveSeq advances the sequence by n and returns its new value, the last
+// of the n reserved values.
+func (c *Client) reserveSeq(ctx context.Context, name string, n uint64) (uint64, error) {
 	var res struct {
 		Seq uint64
 	}
 	filter := bson.D{{"_id", name}}
-	update := bson.D{{"$inc", bson.D{{"seq", 1}}}}
+	update := bson.D{{"$inc", bson.D{{"seq", int64(n)}}}}
 	err := c.counters.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().
+		SetUpsert(true).
 		SetReturnDocument(options.After)).
 		Decode(&res)
 	if err != nil {
@@ -164,3 +517,146 @@ func (c *Client) getNextSeq(ctx context.Context, name string) (uint64, error) {
 	}
 	return res.Seq, nil
 }
+
+// advanceSeq makes the sequence continue after seq if it is not past it yet.
+func (c *Client) advanceSeq(ctx context.Context, name string, seq uint64) error {
+	filter := bson.D{{"_id", name}}
+	update := bson.D{{"$max", bson.D{{"seq", seq}}}}
+	_, err := c.counters.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (c *Client) ensureIndexes(ctx context.Context, expiredRetention time.Duration) error {
+	_, err := c.items.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{"key", 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{"state", 1}, {"deletedAt", 1}},
+		},
+		// admin queries filter by domain and sort by creation time or visits
+		{
+			Keys: bson.D{{"domains", 1}},
+		},
+		{
+			Keys: bson.D{{"createdAt", 1}, {"key", 1}},
+		},
+		{
+			Keys: bson.D{{"visits", 1}, {"key", 1}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.revisions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{"key", 1}, {"version", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	// expired items are purged by mongo in the background, and the revisions
+	// of an expired item with it
+	for _, coll := range []*mongo.Collection{c.items, c.revisions} {
+		err = ensureTTLIndex(ctx, coll, "expiresAt", expiredRetention)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureTTLIndex creates the TTL index of field, or changes the expiry of an
+// existing one created with another retention.
+func ensureTTLIndex(ctx context.Context, coll *mongo.Collection, field string, retention time.Duration) error {
+	seconds := int32(retention / time.Second)
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{field, 1}},
+		Options: options.Index().SetExpireAfterSeconds(seconds),
+	})
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Name != "IndexOptionsConflict" {
+		return err
+	}
+	return coll.Database().RunCommand(ctx, bson.D{
+		{"collMod", coll.Name()},
+		{"index", bson.D{{"keyPattern", bson.D{{field, 1}}}, {"expireAfterSeconds", seconds}}},
+	}).Err()
+}
+
+// backfill sets the domains and key types of the documents stored before
+// they were recorded, so the filters of Query find them and the standard
+// keys are encoded.
+func (c *Client) backfill(ctx context.Context) error {
+	filter := bson.D{{"$or", bson.A{
+		bson.D{{"domains", bson.D{{"$exists", false}}}},
+		bson.D{{"keyType", bson.D{{"$in", bson.A{nil, ""}}}}},
+	}}}
+	opts := options.Find().SetProjection(bson.D{{"key", 1}, {"keyType", 1}, {"redirects", 1}})
+	cur, err := c.items.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	var models []mongo.WriteModel
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		_, err := c.items.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		models = models[:0]
+		return err
+	}
+	for cur.Next(ctx) {
+		var item shortlink.Item
+		err := cur.Decode(&item)
+		if err != nil {
+			return err
+		}
+		fields := bson.D{{"domains", shortlink.Domains(item.Redirects)}}
+		if item.KeyType == "" {
+			keyType, err := shortlink.LegacyKeyType(item.Key)
+			if err != nil {
+				fmt.Printf("error backfilling key type: %v\n", err)
+			} else {
+				fields = append(fields, bson.E{"keyType", keyType})
+			}
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{"key", item.Key}}).
+			SetUpdate(bson.D{{"$set", fields}}))
+		if len(models) == backfillBatchSize {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// itemDoc is the document of a new item, standard items have their ID as
+// _id, the others an ObjectID.
+func itemDoc(id interface{}, key string, data *shortlink.Item) bson.D {
+	return append(bson.D{{"_id", id}}, itemFields(key, data, shortlink.StateActive)...)
+}
+
+func itemFields(key string, data *shortlink.Item, state shortlink.State) bson.D {
+	return bson.D{
+		{"key", key},
+		{"keyType", data.KeyType},
+		{"redirects", data.Redirects},
+		{"visits", data.Visits},
+		{"state", state},
+		{"timezone", data.Timezone},
+		{"expiresAt", data.ExpiresAt},
+		{"version", data.Version},
+		{"createdAt", data.CreatedAt},
+		{"domains", shortlink.Domains(data.Redirects)},
+	}
+}
@@ -0,0 +1,45 @@
+package dbmongo
+
+import (
+	"context"
+	"sync"
+)
+
+const defaultIDBlockSize = 100
+
+// idAllocator hands out IDs from blocks reserved in storage (hi/lo), so only
+// every size-th ID costs a round trip. The IDs left in the block of a
+// crashed instance are never handed out, they leave a gap.
+type idAllocator struct {
+	sync.Mutex
+	size uint64
+	// next and last bound the current block, it is used up if next > last
+	next, last uint64
+	// reserve reserves a block of n IDs and returns the last one
+	reserve func(ctx context.Context, n uint64) (uint64, error)
+}
+
+func (a *idAllocator) nextID(ctx context.Context) (uint64, error) {
+	a.Lock()
+	defer a.Unlock()
+	if a.next > a.last || a.last == 0 {
+		last, err := a.reserve(ctx, a.size)
+		if err != nil {
+			return 0, err
+		}
+		a.next, a.last = last-a.size+1, last
+	}
+	id := a.next
+	a.next++
+	return id, nil
+}
+
+// skipPast drops the IDs up to id from the current block, e.g. after an
+// item was imported under one of them.
+func (a *idAllocator) skipPast(id uint64) {
+	a.Lock()
+	defer a.Unlock()
+	if id >= a.next {
+		a.next = id + 1
+	}
+}
@@ -0,0 +1,451 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"shortlink-service/shortlink"
+	"strconv"
+	"time"
+)
+
+const itemColumns = "key, key_type, redirects, visits, timezone, expires_at, version, updated_at, state, deleted_at, created_at"
+
+type Config struct {
+	// Driver is DriverSQLite or DriverPostgres.
+	Driver string
+	DSN    string
+}
+
+type Client struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func New(ctx context.Context, config Config) (*Client, error) {
+	d, ok := dialects[config.Driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown sql driver %s", config.Driver)
+	}
+	db, err := sql.Open(config.Driver, config.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if d.name == DriverSQLite {
+		// sqlite allows a single writer, one connection avoids busy errors
+		db.SetMaxOpenConns(1)
+	}
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	c := Client{db: db, dialect: d}
+	err = c.migrate(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *Client) Get(ctx context.Context, key string) (*shortlink.Item, error) {
+	item, err := c.getItem(ctx, c.db, key)
+	if err != nil {
+		return nil, err
+	}
+	if item.State == shortlink.StateDeleted {
+		return nil, fmt.Errorf("%w: %s", shortlink.ErrDeleted, key)
+	}
+	return item, nil
+}
+
+func (c *Client) Set(ctx context.Context, key string, data *shortlink.Item) error {
+	_, err := c.insertItem(ctx, c.db, &key, data)
+	if c.dialect.uniqueViolation(err) {
+		return fmt.Errorf("%w: %s", shortlink.ErrKeyExists, key)
+	}
+	return err
+}
+
+func (c *Client) Update(ctx context.Context, key string, data *shortlink.Item, version int) error {
+	redirects, err := json.Marshal(data.Redirects)
+	if err != nil {
+		return err
+	}
+	res, err := c.db.ExecContext(ctx, c.rebind(`UPDATE items
+		SET redirects = ?, domains = ?, timezone = ?, expires_at = ?, updated_at = ?, version = version + 1
+		WHERE key = ? AND state = ? AND version = ?`),
+		string(redirects), domainsColumn(data.Redirects), data.Timezone, utcTime(data.ExpiresAt), utcTime(data.UpdatedAt),
+		key, shortlink.StateActive, version)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	item, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: item with key %s is at version %d", shortlink.ErrVersionConflict, key, item.Version)
+}
+
+func (c *Client) AddRevision(ctx context.Context, rev *shortlink.Revision) error {
+	redirects, err := json.Marshal(rev.Redirects)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.ExecContext(ctx, c.rebind(`INSERT INTO revisions (key, version, redirects, author, created_at)
+		VALUES (?, ?, ?, ?, ?)`),
+		rev.Key, rev.Version, string(redirects), rev.Author, rev.CreatedAt.UTC())
+	if c.dialect.uniqueViolation(err) {
+		return fmt.Errorf("%w: revision %d of %s", shortlink.ErrKeyExists, rev.Version, rev.Key)
+	}
+	return err
+}
+
+func (c *Client) ListRevisions(ctx context.Context, key string) ([]*shortlink.Revision, error) {
+	rows, err := c.db.QueryContext(ctx, c.rebind(`SELECT key, version, redirects, author, created_at
+		FROM revisions WHERE key = ? ORDER BY version`), key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revs []*shortlink.Revision
+	for rows.Next() {
+		var rev shortlink.Revision
+		var redirects []byte
+		err := rows.Scan(&rev.Key, &rev.Version, &redirects, &rev.Author, &rev.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(redirects, &rev.Redirects)
+		if err != nil {
+			return nil, err
+		}
+		revs = append(revs, &rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+// CreateGetID inserts the item without a key and sets the key to the
+// auto-increment ID, in one transaction.
+func (c *Client) CreateGetID(ctx context.Context, data *shortlink.Item) (uint64, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := c.insertItem(ctx, tx, nil, data)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, c.rebind("UPDATE items SET key = ? WHERE id = ?"), strconv.FormatUint(id, 10), id)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (c *Client) Import(ctx context.Context, key string, data *shortlink.Item) error {
+	redirects, err := json.Marshal(data.Redirects)
+	if err != nil {
+		return err
+	}
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, c.rebind("DELETE FROM revisions WHERE key = ?"), key)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, c.rebind("DELETE FROM items WHERE key = ?"), key)
+	if err != nil {
+		return err
+	}
+	// the row gets a new ID, standard keys only have to stay ahead of the sequence
+	_, err = tx.ExecContext(ctx, c.rebind(`INSERT INTO items (`+itemColumns+`, domains)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		key, string(data.KeyType), string(redirects), data.Visits, data.Timezone, utcTime(data.ExpiresAt),
+		data.Version, utcTime(data.UpdatedAt), data.State, utcTime(data.DeletedAt), utcTime(data.CreatedAt),
+		domainsColumn(data.Redirects))
+	if err != nil {
+		return err
+	}
+	if id, ok := shortlink.StandardID(key, data); ok {
+		err = c.dialect.advanceSequence(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete soft deletes the item, it is kept until purged.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.db.ExecContext(ctx, c.rebind("UPDATE items SET state = ?, deleted_at = ? WHERE key = ? AND state = ?"),
+		shortlink.StateDeleted, time.Now().UTC(), key, shortlink.StateActive)
+	return err
+}
+
+func (c *Client) ListDeleted(ctx context.Context, after string, limit int) ([]*shortlink.Item, error) {
+	return c.list(ctx, after, limit, shortlink.StateDeleted)
+}
+
+func (c *Client) Restore(ctx context.Context, key string) error {
+	res, err := c.db.ExecContext(ctx, c.rebind("UPDATE items SET state = ?, deleted_at = NULL WHERE key = ? AND state = ?"),
+		shortlink.StateActive, key, shortlink.StateDeleted)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: deleted item %s", shortlink.ErrNotFound, key)
+	}
+	return nil
+}
+
+// Purge removes the items deleted before the given time, with their revisions.
+func (c *Client) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return c.remove(ctx, "state = ? AND (deleted_at IS NULL OR deleted_at < ?)", shortlink.StateDeleted, deletedBefore.UTC())
+}
+
+func (c *Client) Remove(ctx context.Context, key string) error {
+	_, err := c.remove(ctx, "key = ?", key)
+	return err
+}
+
+func (c *Client) IncVisits(ctx context.Context, key string) error {
+	res, err := c.db.ExecContext(ctx, c.rebind("UPDATE items SET visits = visits + 1 WHERE key = ? AND state = ?"),
+		key, shortlink.StateActive)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		_, err := c.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", shortlink.ErrNotFound, key)
+	}
+	return nil
+}
+
+// AddVisits adds all counts in one transaction.
+func (c *Client) AddVisits(ctx context.Context, visits map[string]int) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, c.rebind("UPDATE items SET visits = visits + ? WHERE key = ? AND state = ?"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for key, n := range visits {
+		_, err = stmt.ExecContext(ctx, n, key, shortlink.StateActive)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (c *Client) GetVisits(ctx context.Context, key string) (int, error) {
+	item, err := c.getItem(ctx, c.db, key)
+	if err != nil {
+		return 0, err
+	}
+	return item.Visits, nil
+}
+
+func (c *Client) List(ctx context.Context, after string, limit int) ([]*shortlink.Item, error) {
+	return c.list(ctx, after, limit, shortlink.StateActive)
+}
+
+// list returns up to limit items in the state with a key greater than after.
+func (c *Client) list(ctx context.Context, after string, limit int, state shortlink.State) ([]*shortlink.Item, error) {
+	query := "SELECT " + itemColumns + " FROM items WHERE key " + c.dialect.binaryCollation + " > ? AND state = ? ORDER BY key " + c.dialect.binaryCollation + " LIMIT ?"
+	return c.query(ctx, query, after, state, limit)
+}
+
+// PurgeExpired removes all items that are expired at the given time and
+// returns the number of removed items.
+func (c *Client) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	return c.remove(ctx, "expires_at <= ?", now.UTC())
+}
+
+// StartSweeper purges the items expired longer than retention ago every
+// interval until ctx is done. Until then expired items respond 410 Gone.
+func (c *Client) StartSweeper(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				_, err := c.PurgeExpired(ctx, now.Add(-retention))
+				if err != nil {
+					fmt.Printf("error purging expired items: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (c *Client) insertItem(ctx context.Context, q querier, key *string, data *shortlink.Item) (uint64, error) {
+	redirects, err := json.Marshal(data.Redirects)
+	if err != nil {
+		return 0, err
+	}
+	var id uint64
+	err = q.QueryRowContext(ctx, c.rebind(`INSERT INTO items (`+itemColumns+`, domains)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULL, ?, ?) RETURNING id`),
+		key, string(data.KeyType), string(redirects), data.Visits, data.Timezone, utcTime(data.ExpiresAt),
+		data.Version, utcTime(data.UpdatedAt), shortlink.StateActive, utcTime(data.CreatedAt),
+		domainsColumn(data.Redirects)).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (c *Client) getItem(ctx context.Context, q querier, key string) (*shortlink.Item, error) {
+	row := q.QueryRowContext(ctx, c.rebind("SELECT "+itemColumns+" FROM items WHERE key = ?"), key)
+	item, err := scanItem(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", shortlink.ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (c *Client) find(ctx context.Context, where string, args ...interface{}) ([]*shortlink.Item, error) {
+	return c.query(ctx, "SELECT "+itemColumns+" FROM items WHERE "+where+" ORDER BY id", args...)
+}
+
+func (c *Client) query(ctx context.Context, query string, args ...interface{}) ([]*shortlink.Item, error) {
+	rows, err := c.db.QueryContext(ctx, c.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*shortlink.Item
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// remove deletes the matching items and their revisions in one transaction.
+func (c *Client) remove(ctx context.Context, where string, args ...interface{}) (int, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, c.rebind("DELETE FROM revisions WHERE key IN (SELECT key FROM items WHERE "+where+")"), args...)
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, c.rebind("DELETE FROM items WHERE "+where), args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanItem(s scanner) (*shortlink.Item, error) {
+	var item shortlink.Item
+	var key sql.NullString
+	var redirects []byte
+	var expiresAt, updatedAt, deletedAt, createdAt sql.NullTime
+	err := s.Scan(&key, &item.KeyType, &redirects, &item.Visits, &item.Timezone, &expiresAt,
+		&item.Version, &updatedAt, &item.State, &deletedAt, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(redirects, &item.Redirects)
+	if err != nil {
+		return nil, err
+	}
+	item.Key = key.String
+	item.ExpiresAt = timePtr(expiresAt)
+	item.UpdatedAt = timePtr(updatedAt)
+	item.DeletedAt = timePtr(deletedAt)
+	item.CreatedAt = timePtr(createdAt)
+	return &item, nil
+}
+
+func utcTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
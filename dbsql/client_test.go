@@ -0,0 +1,281 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"shortlink-service/dbtest"
+	"shortlink-service/shortlink"
+	"shortlink-service/shortner"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient_SQLite(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "shortlinks.db")
+	c, err := New(ctx, Config{Driver: DriverSQLite, DSN: dsn})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+	testClient(t, c)
+
+	t.Log("Testing migrations are applied once...")
+	if err := c.Close(); err != nil {
+		t.Fatalf("error closing dbClient: %v", err)
+	}
+	c, err = New(ctx, Config{Driver: DriverSQLite, DSN: dsn})
+	if err != nil {
+		t.Fatalf("Error reopening dbClient: %v", err)
+	}
+	defer c.Close()
+	var applied int
+	err = c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&applied)
+	if err != nil {
+		t.Fatalf("error counting migrations: %v", err)
+	}
+	ms, err := loadMigrations(DriverSQLite)
+	if err != nil {
+		t.Fatalf("error loading migrations: %v", err)
+	}
+	if applied != len(ms) {
+		t.Errorf("applied migrations mismatch. expected: %d, got: %d", len(ms), applied)
+	}
+}
+
+// TestClient_Postgres runs against the database of DBSQL_POSTGRES_DSN, its tables are emptied.
+func TestClient_Postgres(t *testing.T) {
+	dsn := os.Getenv("DBSQL_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("DBSQL_POSTGRES_DSN is not set")
+	}
+	ctx := context.Background()
+	c, err := New(ctx, Config{Driver: DriverPostgres, DSN: dsn})
+	if err != nil {
+		t.Fatalf("Error creating dbClient: %v", err)
+	}
+	defer c.Close()
+	_, err = c.db.ExecContext(ctx, "TRUNCATE items, revisions RESTART IDENTITY")
+	if err != nil {
+		t.Fatalf("error emptying tables: %v", err)
+	}
+	testClient(t, c)
+}
+
+func testClient(t *testing.T, c *Client) {
+	ctx := context.Background()
+
+	item := shortlink.Item{
+		Redirects: []shortlink.Redirect{
+			{From: 0, To: 24, URL: "https://google.com"},
+		},
+		Version: 1,
+	}
+
+	t.Log("Testing key concurrent increments...")
+	count := 100
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.CreateGetID(ctx, &item)
+			if err != nil {
+				t.Errorf("Error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	items, err := c.List(ctx, "", count+1)
+	if err != nil {
+		t.Fatalf("error getting results: %v", err)
+	}
+	if len(items) != count {
+		t.Errorf("items mismatch. expected: %d, got: %d", count, len(items))
+	}
+
+	t.Log("Testing get...")
+	key := strconv.Itoa(count)
+	slItem, err := c.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("error getting shortlink item: %v", err)
+	}
+	if slItem.Key != key || slItem.Redirects[0].URL != "https://google.com" || slItem.State != shortlink.StateActive {
+		t.Errorf("got wrong item: %+v", slItem)
+	}
+	if err := c.Set(ctx, key, &item); !errors.Is(err, shortlink.ErrKeyExists) {
+		t.Errorf("expected key exists error, got: %v", err)
+	}
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	err = c.Set(ctx, "alias", &shortlink.Item{KeyType: shortlink.KeyTypeCustom, Redirects: item.Redirects, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	slItem, err = c.Get(ctx, "alias")
+	if err != nil {
+		t.Fatalf("error getting shortlink item: %v", err)
+	}
+	if slItem.KeyType != shortlink.KeyTypeCustom || slItem.ExpiresAt == nil || !slItem.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("got wrong item: %+v", slItem)
+	}
+
+	t.Log("Testing visits...")
+	visCount := 200
+	for i := 0; i < visCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.IncVisits(ctx, key)
+			if err != nil {
+				t.Errorf("Error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	v, err := c.GetVisits(ctx, key)
+	if err != nil {
+		t.Fatalf("error get key vists: %v", err)
+	}
+	if v != visCount {
+		t.Errorf("visits mismatch. expected: %d, got: %d", visCount, v)
+	}
+	if err := c.IncVisits(ctx, "missing"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+
+	t.Log("Testing update and revisions...")
+	if err := c.Update(ctx, key, &shortlink.Item{Redirects: item.Redirects}, 2); !errors.Is(err, shortlink.ErrVersionConflict) {
+		t.Errorf("expected version conflict error, got: %v", err)
+	}
+	if err := c.Update(ctx, key, &shortlink.Item{Redirects: item.Redirects}, 1); err != nil {
+		t.Fatalf("error updating item: %v", err)
+	}
+	for _, version := range []int{2, 1} {
+		err := c.AddRevision(ctx, &shortlink.Revision{Key: key, Version: version, Redirects: item.Redirects, CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("error adding revision: %v", err)
+		}
+	}
+	if err := c.AddRevision(ctx, &shortlink.Revision{Key: key, Version: 1, CreatedAt: time.Now()}); !errors.Is(err, shortlink.ErrKeyExists) {
+		t.Errorf("expected key exists error for revision, got: %v", err)
+	}
+	revs, err := c.ListRevisions(ctx, key)
+	if err != nil {
+		t.Fatalf("error listing revisions: %v", err)
+	}
+	if len(revs) != 2 || revs[0].Version != 1 || revs[1].Version != 2 {
+		t.Errorf("revisions mismatch: %+v", revs)
+	}
+
+	t.Log("Testing delete lifecycle...")
+	if err := c.Delete(ctx, key); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	if _, err := c.Get(ctx, key); !errors.Is(err, shortlink.ErrDeleted) {
+		t.Errorf("expected deleted error, got: %v", err)
+	}
+	if err := c.IncVisits(ctx, key); !errors.Is(err, shortlink.ErrDeleted) {
+		t.Errorf("expected deleted error, got: %v", err)
+	}
+	if err := c.Restore(ctx, key); err != nil {
+		t.Fatalf("error restoring item: %v", err)
+	}
+	if err := c.Restore(ctx, key); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+	if err := c.Delete(ctx, key); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	deleted, err := c.ListDeleted(ctx, "", 100)
+	if err != nil || len(deleted) != 1 {
+		t.Errorf("deleted items mismatch: %v (%v)", deleted, err)
+	}
+	if n, err := c.Purge(ctx, time.Now().Add(-time.Minute)); err != nil || n != 0 {
+		t.Errorf("purged %d items deleted after the given time (%v)", n, err)
+	}
+	if n, err := c.Purge(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Errorf("purged items mismatch. expected: %d, got: %d (%v)", 1, n, err)
+	}
+	if _, err := c.Get(ctx, key); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+	if revs, _ := c.ListRevisions(ctx, key); len(revs) != 0 {
+		t.Errorf("revisions of purged item were kept: %+v", revs)
+	}
+
+	t.Log("Testing expiry...")
+	if n, err := c.PurgeExpired(ctx, time.Now()); err != nil || n != 0 {
+		t.Errorf("purged %d items before expiry (%v)", n, err)
+	}
+	if n, err := c.PurgeExpired(ctx, expiresAt); err != nil || n != 1 {
+		t.Errorf("purged items mismatch. expected: %d, got: %d (%v)", 1, n, err)
+	}
+	if _, err := c.Get(ctx, "alias"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+func TestClient_Legacy(t *testing.T) {
+	dbtest.RunLegacy(t, func(t *testing.T, items map[string]*shortlink.Item) shortner.DbClient {
+		ctx := context.Background()
+		dsn := filepath.Join(t.TempDir(), "shortlinks.db")
+
+		// the schema of the first migration, before domains were stored
+		db, err := sql.Open(DriverSQLite, dsn)
+		if err != nil {
+			t.Fatalf("Error opening db: %v", err)
+		}
+		legacy := Client{db: db, dialect: dialects[DriverSQLite]}
+		_, err = db.ExecContext(ctx, "CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at TIMESTAMP NOT NULL)")
+		if err != nil {
+			t.Fatalf("error creating migrations table: %v", err)
+		}
+		ms, err := loadMigrations(DriverSQLite)
+		if err != nil {
+			t.Fatalf("error loading migrations: %v", err)
+		}
+		if err := legacy.apply(ctx, ms[0]); err != nil {
+			t.Fatalf("error applying first migration: %v", err)
+		}
+		for key, item := range items {
+			redirects, err := json.Marshal(item.Redirects)
+			if err != nil {
+				t.Fatalf("error encoding redirects: %v", err)
+			}
+			// the key type was stored from the first migration on
+			keyType, err := shortlink.LegacyKeyType(key)
+			if err != nil {
+				t.Fatalf("error getting key type: %v", err)
+			}
+			_, err = db.ExecContext(ctx, "INSERT INTO items (key, key_type, redirects, version, state) VALUES (?, ?, ?, ?, ?)",
+				key, keyType, string(redirects), item.Version, shortlink.StateActive)
+			if err != nil {
+				t.Fatalf("error inserting legacy item: %v", err)
+			}
+		}
+		db.Close()
+
+		c, err := New(ctx, Config{Driver: DriverSQLite, DSN: dsn})
+		if err != nil {
+			t.Fatalf("Error creating dbClient: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	})
+}
+
+func TestClient_Conformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) shortner.DbClient {
+		c, err := New(context.Background(), Config{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "shortlinks.db")})
+		if err != nil {
+			t.Fatalf("Error creating dbClient: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	})
+}
@@ -0,0 +1,75 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"strconv"
+	"strings"
+)
+
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
+type dialect struct {
+	name string
+	// numbered placeholders ($1, $2, ...) instead of ?
+	numbered bool
+	// binaryCollation orders keys byte-wise like the other backends,
+	// independent of the database locale
+	binaryCollation string
+	uniqueViolation func(err error) bool
+	// advanceSequence makes the item IDs continue after id if they are not past it yet
+	advanceSequence func(ctx context.Context, tx *sql.Tx, id uint64) error
+}
+
+var dialects = map[string]dialect{
+	DriverSQLite: {
+		name:            DriverSQLite,
+		binaryCollation: "COLLATE BINARY",
+		uniqueViolation: func(err error) bool {
+			var serr sqlite3.Error
+			return errors.As(err, &serr) &&
+				(serr.ExtendedCode == sqlite3.ErrConstraintUnique || serr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+		},
+		advanceSequence: func(ctx context.Context, tx *sql.Tx, id uint64) error {
+			_, err := tx.ExecContext(ctx, "UPDATE sqlite_sequence SET seq = ? WHERE name = 'items' AND seq < ?", int64(id), int64(id))
+			return err
+		},
+	},
+	DriverPostgres: {
+		name:            DriverPostgres,
+		numbered:        true,
+		binaryCollation: `COLLATE "C"`,
+		uniqueViolation: func(err error) bool {
+			var perr *pq.Error
+			return errors.As(err, &perr) && perr.Code == "23505"
+		},
+		advanceSequence: func(ctx context.Context, tx *sql.Tx, id uint64) error {
+			_, err := tx.ExecContext(ctx, "SELECT setval(pg_get_serial_sequence('items', 'id'), GREATEST(nextval(pg_get_serial_sequence('items', 'id')), $1))", int64(id))
+			return err
+		},
+	},
+}
+
+// rebind rewrites the ? placeholders of a query for the dialect.
+func (c *Client) rebind(query string) string {
+	if !c.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
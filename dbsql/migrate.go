@@ -0,0 +1,171 @@
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"shortlink-service/shortlink"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrations holds the schema of every dialect as versioned files named
+// <version>_<name>.sql, applied in version order.
+//
+//go:embed migrations
+var migrations embed.FS
+
+type migration struct {
+	version int
+	name    string
+	script  string
+}
+
+// migrationSteps holds the Go steps of migrations, by migration name, run
+// after the script in the same transaction.
+var migrationSteps = map[string]func(ctx context.Context, c *Client, tx *sql.Tx) error{
+	"query": backfillDomains,
+}
+
+// migrate applies the migrations of the dialect that were not applied yet,
+// each in its own transaction with its version recorded in schema_migrations.
+func (c *Client) migrate(ctx context.Context) error {
+	_, err := c.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[int]bool)
+	rows, err := c.db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	pending, err := loadMigrations(c.dialect.name)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		if applied[m.version] {
+			continue
+		}
+		err := c.apply(ctx, m)
+		if err != nil {
+			return fmt.Errorf("migration %d_%s failed: %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) apply(ctx context.Context, m migration) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, m.script)
+	if err != nil {
+		return err
+	}
+	if step, ok := migrationSteps[m.name]; ok {
+		err = step(ctx, c, tx)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, c.rebind("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)"), m.version, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// backfillDomains sets the domains of the items stored before the column was added.
+func backfillDomains(ctx context.Context, c *Client, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT key, redirects FROM items")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	domains := make(map[string]string)
+	for rows.Next() {
+		var key string
+		var data []byte
+		err := rows.Scan(&key, &data)
+		if err != nil {
+			return err
+		}
+		var redirects []shortlink.Redirect
+		err = json.Unmarshal(data, &redirects)
+		if err != nil {
+			return fmt.Errorf("invalid redirects of %s: %w", key, err)
+		}
+		domains[key] = domainsColumn(redirects)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	stmt, err := tx.PrepareContext(ctx, c.rebind("UPDATE items SET domains = ? WHERE key = ?"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for key, d := range domains {
+		_, err = stmt.ExecContext(ctx, d, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ms []migration
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("invalid migration file name %s", e.Name())
+		}
+		script, err := fs.ReadFile(migrations, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, migration{version: version, name: parts[1], script: string(script)})
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		return ms[i].version < ms[j].version
+	})
+	return ms, nil
+}
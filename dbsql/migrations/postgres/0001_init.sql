@@ -0,0 +1,25 @@
+CREATE TABLE items (
+    id         BIGSERIAL PRIMARY KEY,
+    key        TEXT UNIQUE,
+    key_type   TEXT NOT NULL DEFAULT '',
+    redirects  JSONB NOT NULL,
+    visits     INTEGER NOT NULL DEFAULT 0,
+    timezone   TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ,
+    version    INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ,
+    state      SMALLINT NOT NULL,
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX items_expires_at ON items (expires_at);
+CREATE INDEX items_state_deleted_at ON items (state, deleted_at);
+
+CREATE TABLE revisions (
+    key        TEXT NOT NULL,
+    version    INTEGER NOT NULL,
+    redirects  JSONB NOT NULL,
+    author     TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (key, version)
+);
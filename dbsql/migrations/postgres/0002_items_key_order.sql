@@ -0,0 +1,2 @@
+-- List pages through the keys in byte order, independent of the database locale.
+CREATE INDEX items_key_c ON items (key COLLATE "C");
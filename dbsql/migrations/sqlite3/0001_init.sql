@@ -0,0 +1,25 @@
+CREATE TABLE items (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    key        TEXT UNIQUE,
+    key_type   TEXT NOT NULL DEFAULT '',
+    redirects  TEXT NOT NULL,
+    visits     INTEGER NOT NULL DEFAULT 0,
+    timezone   TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP,
+    version    INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP,
+    state      INTEGER NOT NULL,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX items_expires_at ON items (expires_at);
+CREATE INDEX items_state_deleted_at ON items (state, deleted_at);
+
+CREATE TABLE revisions (
+    key        TEXT NOT NULL,
+    version    INTEGER NOT NULL,
+    redirects  TEXT NOT NULL,
+    author     TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (key, version)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE items ADD COLUMN created_at TIMESTAMP;
+-- the hosts the redirects point to, space separated and enclosed in spaces
+ALTER TABLE items ADD COLUMN domains TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX items_created_at ON items (created_at);
+CREATE INDEX items_visits ON items (visits);
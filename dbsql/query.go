@@ -0,0 +1,88 @@
+package dbsql
+
+import (
+	"context"
+	"math"
+	"shortlink-service/shortlink"
+	"strings"
+)
+
+func (c *Client) Query(ctx context.Context, q *shortlink.Query) (*shortlink.QueryResult, error) {
+	// rows without a key are standard items still being created
+	where := []string{"key IS NOT NULL"}
+	var args []interface{}
+	filter := func(cond string, arg interface{}) {
+		where = append(where, cond)
+		args = append(args, arg)
+	}
+	if q.Domain != "" {
+		filter(`domains LIKE ? ESCAPE '\'`, "% "+escapeLike(strings.ToLower(q.Domain))+" %")
+	}
+	if q.CreatedFrom != nil {
+		filter("created_at >= ?", q.CreatedFrom.UTC())
+	}
+	if q.CreatedTo != nil {
+		filter("created_at < ?", q.CreatedTo.UTC())
+	}
+	if q.MinVisits != nil {
+		filter("visits >= ?", *q.MinVisits)
+	}
+	if q.MaxVisits != nil {
+		filter("visits <= ?", *q.MaxVisits)
+	}
+	if q.KeyType != "" {
+		filter("key_type = ?", string(q.KeyType))
+	}
+	if q.State != nil {
+		filter("state = ?", *q.State)
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	err := c.db.QueryRowContext(ctx, c.rebind("SELECT COUNT(*) FROM items WHERE "+cond), args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, nulls := "ASC", "NULLS FIRST"
+	if q.Desc {
+		dir, nulls = "DESC", "NULLS LAST"
+	}
+	key := "key " + c.dialect.binaryCollation
+	var order string
+	switch q.SortBy {
+	case shortlink.SortByCreatedAt:
+		order = "created_at " + dir + " " + nulls + ", " + key
+	case shortlink.SortByVisits:
+		order = "visits " + dir + ", " + key
+	default:
+		order = key + " " + dir
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	items, err := c.query(ctx, "SELECT "+itemColumns+" FROM items WHERE "+cond+" ORDER BY "+order+" LIMIT ? OFFSET ?",
+		append(args, limit, q.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []*shortlink.Item{}
+	}
+	return &shortlink.QueryResult{Items: items, Total: total}, nil
+}
+
+// domainsColumn is the value of the domains column, the hosts of the
+// redirects enclosed in spaces so a LIKE pattern matches whole hosts.
+func domainsColumn(redirects []shortlink.Redirect) string {
+	domains := shortlink.Domains(redirects)
+	if len(domains) == 0 {
+		return ""
+	}
+	return " " + strings.Join(domains, " ") + " "
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,831 @@
+// Package dbtest is a conformance suite for shortner.DbClient
+// implementations, every storage backend runs it from its own tests.
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shortlink-service/shortlink"
+	"shortlink-service/shortner"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// NewClient returns an empty client, it is called once per test.
+type NewClient func(t *testing.T) shortner.DbClient
+
+// Run runs the conformance tests against the clients of newClient.
+func Run(t *testing.T, newClient NewClient) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, c shortner.DbClient)
+	}{
+		{"KeyUniqueness", testKeyUniqueness},
+		{"IDMonotonicity", testIDMonotonicity},
+		{"ConcurrentVisits", testConcurrentVisits},
+		{"Update", testUpdate},
+		{"Revisions", testRevisions},
+		{"DeleteSemantics", testDeleteSemantics},
+		{"List", testList},
+		{"Query", testQuery},
+		{"Import", testImport},
+		{"AddVisits", testAddVisits},
+		{"Errors", testErrors},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newClient(t))
+		})
+	}
+}
+
+// NewLegacyClient stores items the way earlier versions of the backend did,
+// before items had a version, domains or (except for SQL, which stored it
+// from the start) a key type, and returns a client opened on them.
+type NewLegacyClient func(t *testing.T, items map[string]*shortlink.Item) shortner.DbClient
+
+// RunLegacy runs the tests of items stored by earlier versions of the backend
+// against the clients of newClient.
+func RunLegacy(t *testing.T, newClient NewLegacyClient) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, newClient NewLegacyClient)
+	}{
+		{"Update", testLegacyUpdate},
+		{"Query", testLegacyQuery},
+		{"KeyTypes", testLegacyKeyTypes},
+		{"Blocklist", testLegacyBlocklist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newClient)
+		})
+	}
+}
+
+// newLegacyItem returns an item as stored before key types and versions.
+func newLegacyItem(url string) *shortlink.Item {
+	return &shortlink.Item{Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: url}}}
+}
+
+func newItem(url string) *shortlink.Item {
+	return &shortlink.Item{
+		KeyType:   shortlink.KeyTypeCustom,
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: url}},
+		Version:   1,
+	}
+}
+
+func testKeyUniqueness(t *testing.T, c shortner.DbClient) {
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "key", newItem("https://google.com")); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	err := c.Set(ctx, "key", newItem("https://youtube.com"))
+	if !errors.Is(err, shortlink.ErrKeyExists) {
+		t.Errorf("expected key exists error, got: %v", err)
+	}
+	item, err := c.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("error getting item: %v", err)
+	}
+	if item.Redirects[0].URL != "https://google.com" {
+		t.Errorf("item was overwritten: %+v", item)
+	}
+
+	t.Log("Testing concurrent sets of one key...")
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var created, exists int
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.Set(ctx, "contended", newItem("https://google.com"))
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				created++
+			case errors.Is(err, shortlink.ErrKeyExists):
+				exists++
+			default:
+				t.Errorf("Error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if created != 1 || exists != 19 {
+		t.Errorf("expected one set to succeed, got %d created and %d key exists errors", created, exists)
+	}
+}
+
+func testIDMonotonicity(t *testing.T, c shortner.DbClient) {
+	ctx := context.Background()
+
+	var last uint64
+	for i := 0; i < 10; i++ {
+		id, err := c.CreateGetID(ctx, newItem("https://google.com"))
+		if err != nil {
+			t.Fatalf("error creating key: %v", err)
+		}
+		if id <= last {
+			t.Errorf("id %d is not greater than the previous id %d", id, last)
+		}
+		last = id
+	}
+	item, err := c.Get(ctx, strconv.FormatUint(last, 10))
+	if err != nil {
+		t.Fatalf("error getting item by id: %v", err)
+	}
+	if item.Redirects[0].URL != "https://google.com" || item.State != shortlink.StateActive {
+		t.Errorf("got wrong item: %+v", item)
+	}
+
+	t.Log("Testing concurrent ids...")
+	count := 50
+	ids := make(chan uint64, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := c.CreateGetID(ctx, newItem("https://google.com"))
+			if err != nil {
+				t.Errorf("Error: %v", err)
+				return
+			}
+			ids <- id
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	seen := make(map[uint64]bool)
+	for id := range ids {
+		if seen[id] || id <= last {
+			t.Errorf("id %d was handed out twice or is not greater than %d", id, last)
+		}
+		seen[id] = true
+	}
+}
+
+func testConcurrentVisits(t *testing.T, c shortner.DbClient) {
+	ctx := context.Background()
+
+	id, err := c.CreateGetID(ctx, newItem("https://google.com"))
+	if err != nil {
+		t.Fatalf("error creating key: %v", err)
+	}
+	key := strconv.FormatUint(id, 10)
+
+	count := 200
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.IncVisits(ctx, key); err != nil {
+				t.Errorf("Error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	visits, err := c.GetVisits(ctx, key)
+	if err != nil {
+		t.Fatalf("error getting visits: %v", err)
+	}
+	if visits != count {
+		t.Errorf("visits mismatch. expected: %d, got: %d", count, visits)
+	}
+	item, err := c.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("error getting item: %v", err)
+	}
+	if item.Visits != count {
+		t.Errorf("item visits mismatch. expected: %d, got: %d", count, item.Visits)
+	}
+}
+
+func testUpdate(t *testing.T, c shortner.DbClient) {
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "key", newItem("https://google.com")); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	updatedAt := time.Now().UTC().Truncate(time.Second)
+	update := &shortlink.Item{
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://youtube.com"}},
+		Timezone:  "Asia/Jerusalem",
+		UpdatedAt: &updatedAt,
+	}
+	if err := c.Update(ctx, "key", update, 1); err != nil {
+		t.Fatalf("error updating item: %v", err)
+	}
+	if err := c.Update(ctx, "key", update, 1); !errors.Is(err, shortlink.ErrVersionConflict) {
+		t.Errorf("expected version conflict error for stale version, got: %v", err)
+	}
+
+	item, err := c.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("error getting item: %v", err)
+	}
+	if item.Version != 2 || item.Redirects[0].URL != "https://youtube.com" || item.Timezone != "Asia/Jerusalem" {
+		t.Errorf("item was not updated: %+v", item)
+	}
+	if item.KeyType != shortlink.KeyTypeCustom {
+		t.Errorf("update changed the key type to %s", item.KeyType)
+	}
+	if item.UpdatedAt == nil || !item.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("updated at mismatch. expected: %v, got: %v", updatedAt, item.UpdatedAt)
+	}
+}
+
+func testLegacyUpdate(t *testing.T, newClient NewLegacyClient) {
+	ctx := context.Background()
+
+	c := newClient(t, map[string]*shortlink.Item{"1": newLegacyItem("https://google.com")})
+
+	item, err := c.Get(ctx, "1")
+	if err != nil {
+		t.Fatalf("error getting legacy item: %v", err)
+	}
+	update := &shortlink.Item{Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://youtube.com"}}}
+	if err := c.Update(ctx, "1", update, item.Version); err != nil {
+		t.Fatalf("error updating legacy item at version %d: %v", item.Version, err)
+	}
+	if err := c.Update(ctx, "1", update, item.Version); !errors.Is(err, shortlink.ErrVersionConflict) {
+		t.Errorf("expected version conflict error for stale version, got: %v", err)
+	}
+
+	updated, err := c.Get(ctx, "1")
+	if err != nil {
+		t.Fatalf("error getting item: %v", err)
+	}
+	if updated.Version != item.Version+1 || updated.Redirects[0].URL != "https://youtube.com" {
+		t.Errorf("legacy item was not updated: %+v", updated)
+	}
+}
+
+func testLegacyQuery(t *testing.T, newClient NewLegacyClient) {
+	ctx := context.Background()
+
+	c := newClient(t, map[string]*shortlink.Item{
+		"1": newLegacyItem("https://google.com/maps"),
+		"2": newLegacyItem("https://youtube.com"),
+	})
+
+	res, err := c.Query(ctx, &shortlink.Query{Domain: "google.com"})
+	if err != nil {
+		t.Fatalf("error querying items: %v", err)
+	}
+	if res.Total != 1 || len(res.Items) != 1 || res.Items[0].Key != "1" {
+		t.Errorf("legacy items of the domain mismatch: %+v", res)
+	}
+}
+
+func testLegacyKeyTypes(t *testing.T, newClient NewLegacyClient) {
+	ctx := context.Background()
+
+	uuidKey := "8b821463-3c68-4832-47e2-39d905c6d84a"
+	c := newClient(t, map[string]*shortlink.Item{
+		"42":    newLegacyItem("https://google.com"),
+		uuidKey: newLegacyItem("https://youtube.com"),
+	})
+
+	for key, want := range map[string]shortlink.KeyType{"42": shortlink.KeyTypeStandard, uuidKey: shortlink.KeyTypeUuid} {
+		item, err := c.Get(ctx, key)
+		if err != nil || item.KeyType != want {
+			t.Errorf("key type of %s mismatch. expected: %s, got: %+v (%v)", key, want, item, err)
+		}
+	}
+	res, err := c.Query(ctx, &shortlink.Query{KeyType: shortlink.KeyTypeStandard})
+	if err != nil || res.Total != 1 || res.Items[0].Key != "42" {
+		t.Errorf("legacy standard items mismatch: %+v (%v)", res, err)
+	}
+
+	t.Log("Testing the standard keys are listed encoded...")
+	sc, err := shortner.New(ctx, shortner.Config{BaseURL: "http://localhost", KeySecret: "secret", StrictVisits: true}, c)
+	if err != nil {
+		t.Fatalf("error creating shortner client: %v", err)
+	}
+	pub, err := sc.QueryShortLinks(ctx, &shortlink.Query{KeyType: shortlink.KeyTypeStandard})
+	if err != nil || len(pub.Items) != 1 || pub.Items[0].Key == "42" {
+		t.Fatalf("expected the encoded key of the standard item, got: %+v (%v)", pub, err)
+	}
+	item, err := sc.GetShortLink(ctx, pub.Items[0].Key)
+	if err != nil || item.Redirects[0].URL != "https://google.com" {
+		t.Errorf("listed key %s doesn't resolve to the item: %+v (%v)", pub.Items[0].Key, item, err)
+	}
+}
+
+func testLegacyBlocklist(t *testing.T, newClient NewLegacyClient) {
+	ctx := context.Background()
+
+	c := newClient(t, map[string]*shortlink.Item{
+		"42": newLegacyItem("https://google.com"),
+		"43": newLegacyItem("https://youtube.com"),
+	})
+	config := shortner.Config{BaseURL: "http://localhost", KeySecret: "secret", StrictVisits: true}
+	sc, err := shortner.New(ctx, config, c)
+	if err != nil {
+		t.Fatalf("error creating shortner client: %v", err)
+	}
+	res, err := sc.QueryShortLinks(ctx, &shortlink.Query{Domain: "google.com"})
+	if err != nil || len(res.Items) != 1 {
+		t.Fatalf("error querying items: %+v (%v)", res, err)
+	}
+	key := res.Items[0].Key
+
+	config.Blocklist = shortner.NewBlocklist(nil, []string{key})
+	sc, err = shortner.New(ctx, config, c)
+	if err != nil {
+		t.Fatalf("error creating shortner client: %v", err)
+	}
+	blocked, err := sc.BlockedShortLinks(ctx)
+	if err != nil {
+		t.Fatalf("error listing blocked items: %v", err)
+	}
+	if len(blocked) != 1 || blocked[0].Key != key {
+		t.Errorf("expected the legacy standard item %s to be blocked, got: %+v", key, blocked)
+	}
+}
+
+func testRevisions(t *testing.T, c shortner.DbClient) {
+	ctx := context.Background()
+
+	for _, version := range []int{2, 1, 3} {
+		rev := &shortlink.Revision{
+			Key:       "key",
+			Version:   version,
+			Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: fmt.Sprintf("https://google.com/%d", version)}},
+			Author:    "alice",
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := c.AddRevision(ctx, rev); err != nil {
+			t.Fatalf("error adding revision: %v", err)
+		}
+	}
+	err := c.AddRevision(ctx, &shortlink.Revision{Key: "key", Version: 2, CreatedAt: time.Now().UTC()})
+	if !errors.Is(err, shortlink.ErrKeyExists) {
+		t.Errorf("expected key exists error for revision, got: %v", err)
+	}
+	err = c.AddRevision(ctx, &shortlink.Revision{Key: "key-other", Version: 1, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatalf("error adding revision: %v", err)
+	}
+
+	revs, err := c.ListRevisions(ctx, "key")
+	if err != nil {
+		t.Fatalf("error listing revisions: %v", err)
+	}
+	if len(revs) != 3 {
+		t.Fatalf("revisions mismatch. expected: %d, got: %d", 3, len(revs))
+	}
+	for i, rev := range revs {
+		if rev.Version != i+1 || rev.Author != "alice" || rev.Redirects[0].URL != fmt.Sprintf("https://google.com/%d", i+1) {
+			t.Errorf("revision %d mismatch: %+v", i, rev)
+		}
+	}
+	if revs, err := c.ListRevisions(ctx, "missing"); err != nil || len(revs) != 0 {
+		t.Errorf("expected no revisions for missing key, got: %v (%v)", revs, err)
+	}
+}
+
+func testDeleteSemantics(t *testing.T, c shortner.DbClient) {
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "key", newItem("https://google.com")); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	if err := c.AddRevision(ctx, &shortlink.Revision{Key: "key", Version: 1, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("error adding revision: %v", err)
+	}
+
+	if err := c.Delete(ctx, "key"); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	if err := c.Delete(ctx, "key"); err != nil {
+		t.Errorf("deleting a deleted item failed: %v", err)
+	}
+	if err := c.Delete(ctx, "missing"); err != nil {
+		t.Errorf("deleting a missing item failed: %v", err)
+	}
+	if _, err := c.Get(ctx, "key"); !errors.Is(err, shortlink.ErrDeleted) {
+		t.Errorf("expected deleted error, got: %v", err)
+	}
+	if err := c.IncVisits(ctx, "key"); !errors.Is(err, shortlink.ErrDeleted) {
+		t.Errorf("expected deleted error for visits, got: %v", err)
+	}
+	if err := c.Set(ctx, "key", newItem("https://youtube.com")); !errors.Is(err, shortlink.ErrKeyExists) {
+		t.Errorf("expected key exists error for deleted key, got: %v", err)
+	}
+
+	deleted, err := c.ListDeleted(ctx, "", 100)
+	if err != nil {
+		t.Fatalf("error listing deleted items: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].Key != "key" || deleted[0].State != shortlink.StateDeleted || deleted[0].DeletedAt == nil {
+		t.Errorf("deleted items mismatch: %+v", deleted)
+	}
+
+	t.Log("Testing restore...")
+	if err := c.Restore(ctx, "key"); err != nil {
+		t.Fatalf("error restoring item: %v", err)
+	}
+	if err := c.Restore(ctx, "key"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("expected not found error for restoring an active item, got: %v", err)
+	}
+	item, err := c.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("error getting restored item: %v", err)
+	}
+	if item.State != shortlink.StateActive || item.DeletedAt != nil {
+		t.Errorf("restored item mismatch: %+v", item)
+	}
+
+	t.Log("Testing purge...")
+	if err := c.Delete(ctx, "key"); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	if n, err := c.Purge(ctx, time.Now().Add(-time.Minute)); err != nil || n != 0 {
+		t.Errorf("purged %d items deleted after the given time (%v)", n, err)
+	}
+	if n, err := c.Purge(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Errorf("purged items mismatch. expected: %d, got: %d (%v)", 1, n, err)
+	}
+	if _, err := c.Get(ctx, "key"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("expected not found error for purged item, got: %v", err)
+	}
+	if revs, err := c.ListRevisions(ctx, "key"); err != nil || len(revs) != 0 {
+		t.Errorf("revisions of purged item were kept: %v (%v)", revs, err)
+	}
+	if err := c.Set(ctx, "key", newItem("https://youtube.com")); err != nil {
+		t.Errorf("error reusing purged key: %v", err)
+	}
+
+	t.Log("Testing remove...")
+	if err := c.AddRevision(ctx, &shortlink.Revision{Key: "key", Version: 1, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("error adding revision: %v", err)
+	}
+	if err := c.Remove(ctx, "key"); err != nil {
+		t.Fatalf("error removing item: %v", err)
+	}
+	if err := c.Remove(ctx, "missing"); err != nil {
+		t.Errorf("removing a missing item failed: %v", err)
+	}
+	if _, err := c.Get(ctx, "key"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("expected not found error for removed item, got: %v", err)
+	}
+	if err := c.Restore(ctx, "key"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("expected not found error for restoring a removed item, got: %v", err)
+	}
+	if deleted, err := c.ListDeleted(ctx, "", 100); err != nil || len(deleted) != 0 {
+		t.Errorf("removed item is listed as deleted: %v (%v)", deleted, err)
+	}
+	if revs, err := c.ListRevisions(ctx, "key"); err != nil || len(revs) != 0 {
+		t.Errorf("revisions of removed item were kept: %v (%v)", revs, err)
+	}
+}
+
+func testList(t *testing.T, c shortner.DbClient) {
+	ctx := context.Background()
+
+	var keys []string
+	for i := 0; i < 5; i++ {
+		id, err := c.CreateGetID(ctx, newItem(fmt.Sprintf("https://google.com/%d", i)))
+		if err != nil {
+			t.Fatalf("error creating key: %v", err)
+		}
+		keys = append(keys, strconv.FormatUint(id, 10))
+	}
+	if err := c.Set(ctx, "alias", newItem("https://google.com/alias")); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	keys = append(keys, "alias")
+	if err := c.Set(ctx, "Alias", newItem("https://google.com/Alias")); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	keys = append(keys, "Alias")
+	if err := c.Delete(ctx, keys[0]); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	if err := c.IncVisits(ctx, "alias"); err != nil {
+		t.Fatalf("error incrementing visits: %v", err)
+	}
+
+	var got []string
+	after := ""
+	for {
+		items, err := c.List(ctx, after, 2)
+		if err != nil {
+			t.Fatalf("error listing items: %v", err)
+		}
+		if len(items) > 2 {
+			t.Fatalf("expected at most 2 items per page, got: %d", len(items))
+		}
+		for _, item := range items {
+			got = append(got, item.Key)
+			stored, err := c.Get(ctx, item.Key)
+			if err != nil {
+				t.Errorf("listed item %s can't be read: %v", item.Key, err)
+				continue
+			}
+			if item.State != shortlink.StateActive || item.Visits != stored.Visits || item.Redirects[0].URL != stored.Redirects[0].URL {
+				t.Errorf("listed item %s mismatch. expected: %+v, got: %+v", item.Key, stored, item)
+			}
+		}
+		if len(items) == 0 {
+			break
+		}
+		after = items[len(items)-1].Key
+	}
+	want := append([]string(nil), keys[1:]...)
+	sort.Strings(want)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("listed keys mismatch. expected: %v, got: %v", want, got)
+	}
+
+	// the cursor doesn't have to be a stored key
+	items, err := c.List(ctx, "alias0", 10)
+	if err != nil || len(items) != 0 {
+		t.Errorf("expected no items after the last key, got: %v (%v)", items, err)
+	}
+	items, err = c.List(ctx, "B", 10)
+	if err != nil || len(items) != 1 || items[0].Key != "alias" {
+		t.Errorf("expected the items after B, got: %v (%v)", items, err)
+	}
+
+	// the deleted items page the same way
+	if err := c.Delete(ctx, "Alias"); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	got = nil
+	after = ""
+	for {
+		items, err := c.ListDeleted(ctx, after, 1)
+		if err != nil {
+			t.Fatalf("error listing deleted items: %v", err)
+		}
+		if len(items) > 1 {
+			t.Fatalf("expected at most 1 deleted item per page, got: %d", len(items))
+		}
+		if len(items) == 0 {
+			break
+		}
+		if items[0].State != shortlink.StateDeleted {
+			t.Errorf("listed deleted item %s has state %v", items[0].Key, items[0].State)
+		}
+		got = append(got, items[0].Key)
+		after = items[0].Key
+	}
+	want = []string{keys[0], "Alias"}
+	sort.Strings(want)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("listed deleted keys mismatch. expected: %v, got: %v", want, got)
+	}
+}
+
+func testQuery(t *testing.T, c shortner.DbClient) {
+	ctx := context.Background()
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	create := func(key string, kt shortlink.KeyType, created *time.Time, visits int, urls ...string) string {
+		t.Helper()
+		item := newItem(urls[0])
+		item.KeyType = kt
+		item.CreatedAt = created
+		for _, u := range urls[1:] {
+			item.Redirects = append(item.Redirects, shortlink.Redirect{From: 0, To: 24, URL: u})
+		}
+		if key == "" {
+			id, err := c.CreateGetID(ctx, item)
+			if err != nil {
+				t.Fatalf("error creating key: %v", err)
+			}
+			key = strconv.FormatUint(id, 10)
+		} else if err := c.Set(ctx, key, item); err != nil {
+			t.Fatalf("error setting item: %v", err)
+		}
+		for i := 0; i < visits; i++ {
+			if err := c.IncVisits(ctx, key); err != nil {
+				t.Fatalf("error incrementing visits: %v", err)
+			}
+		}
+		return key
+	}
+	at := func(h int) *time.Time {
+		t := t0.Add(time.Duration(h) * time.Hour)
+		return &t
+	}
+	a := create("a", shortlink.KeyTypeCustom, at(0), 0, "https://google.com")
+	b := create("b", shortlink.KeyTypeRandom, at(1), 3, "https://www.youtube.com/watch")
+	d := create("d", shortlink.KeyTypeCustom, at(2), 5, "https://google.com/search", "http://example.org:8080")
+	std := create("", shortlink.KeyTypeStandard, nil, 1, "https://Google.com/maps")
+	if err := c.Delete(ctx, d); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+
+	active, deleted := shortlink.StateActive, shortlink.StateDeleted
+	one, three := 1, 3
+	byKey := func(keys ...string) []string {
+		sort.Strings(keys)
+		return keys
+	}
+	tests := []struct {
+		name  string
+		query shortlink.Query
+		keys  []string
+		total int
+	}{
+		{"all", shortlink.Query{}, byKey(a, b, d, std), 4},
+		{"domain", shortlink.Query{Domain: "GOOGLE.com"}, byKey(a, d, std), 3},
+		{"domain port", shortlink.Query{Domain: "example.org"}, []string{d}, 1},
+		{"domain exact host", shortlink.Query{Domain: "youtube.com"}, []string{}, 0},
+		{"created from", shortlink.Query{CreatedFrom: at(1)}, []string{b, d}, 2},
+		{"created to", shortlink.Query{CreatedTo: at(1)}, []string{a}, 1},
+		{"visits", shortlink.Query{MinVisits: &one, MaxVisits: &three}, byKey(b, std), 2},
+		{"key type", shortlink.Query{KeyType: shortlink.KeyTypeCustom}, []string{a, d}, 2},
+		{"active", shortlink.Query{State: &active}, byKey(a, b, std), 3},
+		{"deleted", shortlink.Query{State: &deleted}, []string{d}, 1},
+		{"key desc", shortlink.Query{Desc: true}, []string{d, b, a, std}, 4},
+		{"visits desc", shortlink.Query{SortBy: shortlink.SortByVisits, Desc: true}, []string{d, b, std, a}, 4},
+		{"created at", shortlink.Query{SortBy: shortlink.SortByCreatedAt}, []string{std, a, b, d}, 4},
+		{"created at desc", shortlink.Query{SortBy: shortlink.SortByCreatedAt, Desc: true}, []string{d, b, a, std}, 4},
+		{"page", shortlink.Query{SortBy: shortlink.SortByVisits, Desc: true, Offset: 1, Limit: 2}, []string{b, std}, 4},
+		{"page past the end", shortlink.Query{Offset: 10, Limit: 2}, []string{}, 4},
+	}
+	for _, tt := range tests {
+		res, err := c.Query(ctx, &tt.query)
+		if err != nil {
+			t.Errorf("%s: error querying items: %v", tt.name, err)
+			continue
+		}
+		got := []string{}
+		for _, item := range res.Items {
+			got = append(got, item.Key)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.keys) || res.Total != tt.total {
+			t.Errorf("%s: result mismatch. expected: %v (%d), got: %v (%d)", tt.name, tt.keys, tt.total, got, res.Total)
+		}
+	}
+
+	res, err := c.Query(ctx, &shortlink.Query{Domain: "youtube.com", State: &active})
+	if err != nil || res.Items == nil {
+		t.Errorf("expected an empty page, got: %v (%v)", res, err)
+	}
+	res, err = c.Query(ctx, &shortlink.Query{KeyType: shortlink.KeyTypeRandom})
+	if err != nil || len(res.Items) != 1 {
+		t.Fatalf("error querying items: %v (%v)", res, err)
+	}
+	if item := res.Items[0]; item.Visits != 3 || item.CreatedAt == nil || !item.CreatedAt.Equal(*at(1)) || item.State != active {
+		t.Errorf("queried item mismatch: %+v", item)
+	}
+}
+
+func testImport(t *testing.T, c shortner.DbClient) {
+	ctx := context.Background()
+
+	id, err := c.CreateGetID(ctx, newItem("https://google.com"))
+	if err != nil {
+		t.Fatalf("error creating key: %v", err)
+	}
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	deletedAt := created.Add(time.Hour)
+
+	t.Log("Testing imported items keep their state....")
+	std := newItem("https://google.com/imported")
+	std.KeyType = shortlink.KeyTypeStandard
+	std.Visits = 7
+	std.Version = 3
+	std.CreatedAt = &created
+	std.State = shortlink.StateDeleted
+	std.DeletedAt = &deletedAt
+	stdKey := strconv.FormatUint(id+41, 10)
+	if err := c.Import(ctx, stdKey, std); err != nil {
+		t.Fatalf("error importing item: %v", err)
+	}
+	if _, err := c.Get(ctx, stdKey); !errors.Is(err, shortlink.ErrDeleted) {
+		t.Errorf("expected deleted error, got: %v", err)
+	}
+	deleted, err := c.ListDeleted(ctx, "", 100)
+	if err != nil || len(deleted) != 1 {
+		t.Fatalf("unexpected deleted items: %v (%v)", deleted, err)
+	}
+	if d := deleted[0]; d.Key != stdKey || d.Visits != 7 || d.Version != 3 || d.CreatedAt == nil || !d.CreatedAt.Equal(created) ||
+		d.DeletedAt == nil || !d.DeletedAt.Equal(deletedAt) {
+		t.Errorf("imported item mismatch: %+v", d)
+	}
+
+	t.Log("Testing IDs continue after imported standard keys....")
+	next, err := c.CreateGetID(ctx, newItem("https://google.com"))
+	if err != nil {
+		t.Fatalf("error creating key: %v", err)
+	}
+	if next <= id+41 {
+		t.Errorf("expected an ID after %d, got: %d", id+41, next)
+	}
+
+	t.Log("Testing import replaces stored items....")
+	if err := c.Set(ctx, "alias", newItem("https://google.com")); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	if err := c.AddRevision(ctx, &shortlink.Revision{Key: "alias", Version: 1, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("error adding revision: %v", err)
+	}
+	alias := newItem("https://youtube.com")
+	alias.Visits = 2
+	alias.State = shortlink.StateActive
+	for _, key := range []string{"alias", strconv.FormatUint(id, 10)} {
+		if err := c.Import(ctx, key, alias); err != nil {
+			t.Fatalf("error importing item: %v", err)
+		}
+		item, err := c.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("error getting imported item: %v", err)
+		}
+		if item.Redirects[0].URL != "https://youtube.com" || item.Visits != 2 {
+			t.Errorf("imported item %s mismatch: %+v", key, item)
+		}
+		if revs, err := c.ListRevisions(ctx, key); err != nil || len(revs) != 0 {
+			t.Errorf("revisions of the replaced item %s were kept: %v (%v)", key, revs, err)
+		}
+	}
+	if _, err := c.Get(ctx, strconv.FormatUint(next, 10)); err != nil {
+		t.Errorf("import changed another item: %v", err)
+	}
+}
+
+func testAddVisits(t *testing.T, c shortner.DbClient) {
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "deleted"} {
+		if err := c.Set(ctx, key, newItem("https://google.com")); err != nil {
+			t.Fatalf("error setting item: %v", err)
+		}
+	}
+	if err := c.Delete(ctx, "deleted"); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+
+	if err := c.AddVisits(ctx, map[string]int{}); err != nil {
+		t.Errorf("error adding no visits: %v", err)
+	}
+	err := c.AddVisits(ctx, map[string]int{"a": 3, "b": 1, "deleted": 2, "missing": 1})
+	if err != nil {
+		t.Fatalf("error adding visits: %v", err)
+	}
+	if err := c.AddVisits(ctx, map[string]int{"a": 2}); err != nil {
+		t.Fatalf("error adding visits: %v", err)
+	}
+	for key, want := range map[string]int{"a": 5, "b": 1} {
+		if v, err := c.GetVisits(ctx, key); err != nil || v != want {
+			t.Errorf("visits of %s mismatch. expected: %d, got: %d (%v)", key, want, v, err)
+		}
+	}
+	deleted, err := c.ListDeleted(ctx, "", 100)
+	if err != nil || len(deleted) != 1 || deleted[0].Visits != 0 {
+		t.Errorf("expected the deleted item to be skipped, got: %v (%v)", deleted, err)
+	}
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+func testErrors(t *testing.T, c shortner.DbClient) {
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("Get: expected not found error, got: %v", err)
+	}
+	if _, err := c.GetVisits(ctx, "missing"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("GetVisits: expected not found error, got: %v", err)
+	}
+	if err := c.IncVisits(ctx, "missing"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("IncVisits: expected not found error, got: %v", err)
+	}
+	if err := c.Update(ctx, "missing", newItem("https://google.com"), 1); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("Update: expected not found error, got: %v", err)
+	}
+	if err := c.Restore(ctx, "missing"); !errors.Is(err, shortlink.ErrNotFound) {
+		t.Errorf("Restore: expected not found error, got: %v", err)
+	}
+
+	if err := c.Set(ctx, "deleted", newItem("https://google.com")); err != nil {
+		t.Fatalf("error setting item: %v", err)
+	}
+	if err := c.Delete(ctx, "deleted"); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	if err := c.Update(ctx, "deleted", newItem("https://google.com"), 1); !errors.Is(err, shortlink.ErrDeleted) {
+		t.Errorf("Update: expected deleted error, got: %v", err)
+	}
+	if items, err := c.List(ctx, "", 10); err != nil || len(items) != 0 {
+		t.Errorf("List: expected no active items, got: %v (%v)", items, err)
+	}
+}
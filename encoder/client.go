@@ -2,37 +2,168 @@ package encoder
 
 import (
 	"errors"
-	"math"
+	"fmt"
+	"math/bits"
 	"strings"
 )
 
-const (
-	alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	length   = uint64(len(alphabet))
-)
+// DefaultAlphabet is the base62 alphabet used when Config.Alphabet is empty.
+const DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-func Encode(number uint64) string {
+var defaultCodec = mustNewCodec(Config{MinLength: 1})
+
+type Config struct {
+	// Alphabet holds the key characters, DefaultAlphabet if empty.
+	Alphabet string
+	// MinLength pads shorter keys with the first alphabet character.
+	MinLength int
+	// CheckChar appends a check character, so Decode rejects most typos.
+	CheckChar bool
+}
+
+// Codec encodes IDs to keys in a custom alphabet, least significant digit first.
+type Codec struct {
+	alphabet  string
+	base      uint64
+	checkMod  uint64
+	minLength int
+	checkChar bool
+}
+
+func NewCodec(config Config) (*Codec, error) {
+	alphabet := config.Alphabet
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	if len(alphabet) < 2 {
+		return nil, errors.New("alphabet must have at least 2 characters")
+	}
+	for i, symbol := range alphabet {
+		if !isURLSafe(symbol) {
+			return nil, fmt.Errorf("alphabet character %q is not url safe", symbol)
+		}
+		if strings.IndexRune(alphabet, symbol) != i {
+			return nil, fmt.Errorf("alphabet character %q is duplicated", symbol)
+		}
+	}
+	if config.MinLength < 0 {
+		return nil, errors.New("min length must not be negative")
+	}
+
+	c := Codec{
+		alphabet:  alphabet,
+		base:      uint64(len(alphabet)),
+		checkMod:  largestPrime(uint64(len(alphabet))),
+		minLength: config.MinLength,
+		checkChar: config.CheckChar,
+	}
+	return &c, nil
+}
+
+func mustNewCodec(config Config) *Codec {
+	c, err := NewCodec(config)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func (c *Codec) Alphabet() string {
+	return c.alphabet
+}
+
+func (c *Codec) Encode(number uint64) string {
 	var encodedBuilder strings.Builder
-	encodedBuilder.Grow(11)
+	encodedBuilder.Grow(c.minLength + 12)
 
-	for ; number > 0; number = number / length {
-		encodedBuilder.WriteByte(alphabet[(number % length)])
+	for ; number > 0; number = number / c.base {
+		encodedBuilder.WriteByte(c.alphabet[(number % c.base)])
+	}
+	for encodedBuilder.Len() < c.minLength {
+		encodedBuilder.WriteByte(c.alphabet[0])
 	}
 
-	return encodedBuilder.String()
+	encoded := encodedBuilder.String()
+	if c.checkChar {
+		encoded += string(c.alphabet[c.checksum(encoded)])
+	}
+	return encoded
 }
 
-func Decode(encoded string) (uint64, error) {
+func (c *Codec) Decode(encoded string) (uint64, error) {
+	if c.checkChar {
+		if len(encoded) < 2 {
+			return 0, errors.New("key is too short")
+		}
+		check := encoded[len(encoded)-1]
+		encoded = encoded[:len(encoded)-1]
+		if strings.IndexByte(c.alphabet, check) == -1 || c.alphabet[c.checksum(encoded)] != check {
+			return 0, errors.New("invalid check character")
+		}
+	}
+
 	var number uint64
 
-	for i, symbol := range encoded {
-		alphabeticPosition := strings.IndexRune(alphabet, symbol)
+	// the most significant digit is the last one
+	for i := len(encoded) - 1; i >= 0; i-- {
+		alphabeticPosition := strings.IndexByte(c.alphabet, encoded[i])
 
 		if alphabeticPosition == -1 {
-			return uint64(alphabeticPosition), errors.New("invalid character: " + string(symbol))
+			return 0, errors.New("invalid character: " + string(encoded[i]))
+		}
+		hi, lo := bits.Mul64(number, c.base)
+		sum, carry := bits.Add64(lo, uint64(alphabeticPosition), 0)
+		if hi != 0 || carry != 0 {
+			return 0, errors.New("key overflows")
 		}
-		number += uint64(alphabeticPosition) * uint64(math.Pow(float64(length), float64(i)))
+		number = sum
+	}
+
+	// only the encoding padded exactly to the min length is valid, so every
+	// number has a single key
+	if len(encoded) < c.minLength || len(encoded) > c.minLength && encoded[len(encoded)-1] == c.alphabet[0] {
+		return 0, errors.New("key is not canonical")
 	}
 
 	return number, nil
 }
+
+// checksum weights every digit by its position, modulo the largest prime not
+// above the base, so a changed digit or swapped neighbours change the sum.
+func (c *Codec) checksum(encoded string) uint64 {
+	var sum uint64
+	for i := 0; i < len(encoded); i++ {
+		digit := uint64(strings.IndexByte(c.alphabet, encoded[i]))
+		sum = (sum + uint64(i+1)%c.checkMod*digit) % c.checkMod
+	}
+	return sum
+}
+
+func Encode(number uint64) string {
+	return defaultCodec.Encode(number)
+}
+
+func Decode(encoded string) (uint64, error) {
+	return defaultCodec.Decode(encoded)
+}
+
+func isURLSafe(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		r == '-' || r == '_' || r == '.' || r == '~'
+}
+
+func largestPrime(n uint64) uint64 {
+	for p := n; p > 2; p-- {
+		prime := true
+		for d := uint64(2); d*d <= p; d++ {
+			if p%d == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return p
+		}
+	}
+	return 2
+}
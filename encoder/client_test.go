@@ -1,6 +1,11 @@
 package encoder
 
-import "testing"
+import (
+	"math"
+	"strings"
+	"testing"
+	"testing/quick"
+)
 
 func TestEncoder(t *testing.T) {
 	var id uint64 = 8912323
@@ -17,3 +22,109 @@ func TestEncoder(t *testing.T) {
 	}
 	t.Logf("Decoded back: %d", decoded)
 }
+
+func TestCodec(t *testing.T) {
+	c, err := NewCodec(Config{Alphabet: "23456789abcdefghjkmnpqrstuvwxyz", MinLength: 4, CheckChar: true})
+	if err != nil {
+		t.Fatalf("Error creating codec: %v", err)
+	}
+
+	for _, id := range []uint64{0, 1, 30, 31, 8912323} {
+		encoded := c.Encode(id)
+		if len(encoded) < 5 {
+			t.Errorf("Encoded value %s of %d is shorter than min length and check character", encoded, id)
+		}
+		decoded, err := c.Decode(encoded)
+		if err != nil {
+			t.Fatalf("Error decoding %s: %v", encoded, err)
+		}
+		if decoded != id {
+			t.Fatalf("Decode value mismatch. expected: %d, got: %d", id, decoded)
+		}
+	}
+
+	encoded := c.Encode(8912323)
+	typo := []byte(encoded)
+	typo[1] = c.Alphabet()[(strings.IndexByte(c.Alphabet(), typo[1])+1)%len(c.Alphabet())]
+	if _, err := c.Decode(string(typo)); err == nil {
+		t.Errorf("Decode accepted typo %s of %s", typo, encoded)
+	}
+	swapped := []byte(encoded)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	if _, err := c.Decode(string(swapped)); err == nil && swapped[0] != swapped[1] {
+		t.Errorf("Decode accepted swapped %s of %s", swapped, encoded)
+	}
+
+	if Encode(0) == "" {
+		t.Error("Encode(0) returned an empty key")
+	}
+	for _, alphabet := range []string{"a", "abca", "ab/c"} {
+		if _, err := NewCodec(Config{Alphabet: alphabet}); err == nil {
+			t.Errorf("NewCodec accepted alphabet %s", alphabet)
+		}
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	configs := []Config{
+		{},
+		{MinLength: 1},
+		{MinLength: 6, CheckChar: true},
+		{Alphabet: "01"},
+		{Alphabet: "23456789abcdefghjkmnpqrstuvwxyz", MinLength: 3, CheckChar: true},
+	}
+
+	for _, config := range configs {
+		c, err := NewCodec(config)
+		if err != nil {
+			t.Fatalf("Error creating codec: %v", err)
+		}
+
+		encodeDecode := func(id uint64) bool {
+			decoded, err := c.Decode(c.Encode(id))
+			return err == nil && decoded == id
+		}
+		if err := quick.Check(encodeDecode, nil); err != nil {
+			t.Errorf("%+v: encode/decode round trip failed: %v", config, err)
+		}
+		for _, id := range []uint64{0, 1, c.base - 1, c.base, math.MaxUint64} {
+			if !encodeDecode(id) {
+				t.Errorf("%+v: encode/decode round trip failed for %d", config, id)
+			}
+		}
+
+		// every key that decodes is the only key of its number
+		decodeEncode := func(digits []byte) bool {
+			key := make([]byte, len(digits))
+			for i, d := range digits {
+				key[i] = c.alphabet[int(d)%len(c.alphabet)]
+			}
+			decoded, err := c.Decode(string(key))
+			return err != nil || c.Encode(decoded) == string(key)
+		}
+		if err := quick.Check(decodeEncode, nil); err != nil {
+			t.Errorf("%+v: decode/encode round trip failed: %v", config, err)
+		}
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	max := Encode(math.MaxUint64)
+	t.Logf("max key: %s", max)
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"overflow", max[:len(max)-1] + DefaultAlphabet[len(DefaultAlphabet)-1:]},
+		{"too long", max + "b"},
+		{"trailing padding", "ea"},
+		{"empty", ""},
+		{"invalid character", "e-"},
+	}
+	for _, tt := range tests {
+		if decoded, err := Decode(tt.encoded); err == nil {
+			t.Errorf("%s: Decode(%q) accepted as %d", tt.name, tt.encoded, decoded)
+		}
+	}
+}
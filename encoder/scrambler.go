@@ -0,0 +1,85 @@
+package encoder
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+const (
+	scramblerRounds = 4
+	smallDomainBits = 32
+)
+
+// Scrambler is a keyed, reversible permutation of IDs, so consecutive IDs
+// don't map to consecutive keys. IDs below 2^32 are permuted among
+// themselves to keep their keys short, larger IDs are permuted among the
+// larger ones. A nil Scrambler leaves IDs unchanged.
+type Scrambler struct {
+	secret []byte
+}
+
+// NewScrambler returns a scrambler keyed by secret, or nil for an empty secret.
+func NewScrambler(secret string) *Scrambler {
+	if secret == "" {
+		return nil
+	}
+	return &Scrambler{secret: []byte(secret)}
+}
+
+func (s *Scrambler) Scramble(id uint64) uint64 {
+	if s == nil {
+		return id
+	}
+	if id < 1<<smallDomainBits {
+		return s.feistel(id, smallDomainBits, false)
+	}
+	// cycle walk until the result leaves the small domain again
+	id = s.feistel(id, 64, false)
+	for id < 1<<smallDomainBits {
+		id = s.feistel(id, 64, false)
+	}
+	return id
+}
+
+func (s *Scrambler) Unscramble(id uint64) uint64 {
+	if s == nil {
+		return id
+	}
+	if id < 1<<smallDomainBits {
+		return s.feistel(id, smallDomainBits, true)
+	}
+	id = s.feistel(id, 64, true)
+	for id < 1<<smallDomainBits {
+		id = s.feistel(id, 64, true)
+	}
+	return id
+}
+
+// feistel runs a balanced feistel network over the low bits of x.
+func (s *Scrambler) feistel(x uint64, bits uint, inverse bool) uint64 {
+	half := bits / 2
+	mask := uint64(1)<<half - 1
+	l, r := x>>half&mask, x&mask
+
+	for i := 0; i < scramblerRounds; i++ {
+		if inverse {
+			round := scramblerRounds - 1 - i
+			l, r = r^s.round(round, bits, l)&mask, l
+		} else {
+			l, r = r, l^s.round(i, bits, r)&mask
+		}
+	}
+
+	return l<<half | r
+}
+
+func (s *Scrambler) round(i int, bits uint, v uint64) uint64 {
+	var buf [10]byte
+	buf[0] = byte(i)
+	buf[1] = byte(bits)
+	binary.BigEndian.PutUint64(buf[2:], v)
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(buf[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
@@ -0,0 +1,35 @@
+package encoder
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScrambler(t *testing.T) {
+	s := NewScrambler("secret")
+
+	ids := []uint64{0, 1, 2, 3, 61, 62, 8912323, 1<<32 - 1, 1 << 32, 1<<40 + 7, math.MaxUint64}
+	seen := make(map[uint64]bool)
+	for _, id := range ids {
+		scrambled := s.Scramble(id)
+		if seen[scrambled] {
+			t.Errorf("scrambled value %d is not unique", scrambled)
+		}
+		seen[scrambled] = true
+		if (id < 1<<32) != (scrambled < 1<<32) {
+			t.Errorf("scrambled value %d of %d left its domain", scrambled, id)
+		}
+		if back := s.Unscramble(scrambled); back != id {
+			t.Errorf("Unscramble mismatch. expected: %d, got: %d", id, back)
+		}
+	}
+	t.Logf("keys of 1, 2, 3: %s %s %s", Encode(s.Scramble(1)), Encode(s.Scramble(2)), Encode(s.Scramble(3)))
+
+	var plain *Scrambler
+	if plain.Scramble(5) != 5 || plain.Unscramble(5) != 5 {
+		t.Error("nil scrambler changed the id")
+	}
+	if NewScrambler("other").Scramble(1) == s.Scramble(1) {
+		t.Error("different secrets scrambled the same")
+	}
+}
@@ -3,8 +3,12 @@ module shortlink-service
 go 1.16
 
 require (
-	github.com/go-chi/chi/v5 v5.0.4 // indirect
-	github.com/joho/godotenv v1.3.0 // indirect
-	github.com/nu7hatch/gouuid v0.0.0-20131221200532-179d4d0c4d8d // indirect
-	go.mongodb.org/mongo-driver v1.7.2 // indirect
+	github.com/go-chi/chi/v5 v5.0.4
+	github.com/google/btree v1.0.1
+	github.com/joho/godotenv v1.3.0
+	github.com/lib/pq v1.10.3
+	github.com/mattn/go-sqlite3 v1.14.8
+	github.com/nu7hatch/gouuid v0.0.0-20131221200532-179d4d0c4d8d
+	go.etcd.io/bbolt v1.3.6
+	go.mongodb.org/mongo-driver v1.7.2
 )
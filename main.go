@@ -2,19 +2,35 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/joho/godotenv"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"shortlink-service/dbbolt"
+	"shortlink-service/dbcache"
+	"shortlink-service/dbmemory"
 	"shortlink-service/dbmongo"
+	"shortlink-service/dbsql"
+	"shortlink-service/encoder"
 	"shortlink-service/server"
 	"shortlink-service/shortner"
+	"strconv"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 )
 
-const defaultPort = "8080"
+const (
+	defaultPort             = "8080"
+	defaultDeletedRetention = 30 * 24 * time.Hour
+	defaultExpiredRetention = 7 * 24 * time.Hour
+	defaultBoltPath         = "shortlinks.db"
+	shutdownTimeout         = 30 * time.Second
+)
 
 func main() {
 	ctx := context.Background()
@@ -29,28 +45,240 @@ func main() {
 		port = defaultPort
 	}
 
-	dbClient, err := dbmongo.New(ctx, dbmongo.Config{
-		URI:           os.Getenv("MONGO_URI"),
-		DbName:        os.Getenv("MONGO_DB"),
-		ItemsCollName: os.Getenv("MONGO_COLLECTION"),
-	})
+	dbClient, err := newDbClient(ctx)
 	if err != nil {
 		log.Fatalf("Error create db client: %v", err)
 	}
+	if os.Getenv("CACHE_ENABLED") == "true" {
+		dbClient, err = newCache(ctx, dbClient)
+		if err != nil {
+			log.Fatalf("Error create cache: %v", err)
+		}
+	}
 
-	shortnerClient, err := shortner.New(ctx, os.Getenv("SHORTLINK_BASE_URL"), dbClient)
+	keyMinLength := 1
+	if v := os.Getenv("SHORTLINK_KEY_MIN_LENGTH"); v != "" {
+		keyMinLength, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid SHORTLINK_KEY_MIN_LENGTH: %v", err)
+		}
+	}
+	codec, err := encoder.NewCodec(encoder.Config{
+		Alphabet:  os.Getenv("SHORTLINK_KEY_ALPHABET"),
+		MinLength: keyMinLength,
+		CheckChar: os.Getenv("SHORTLINK_KEY_CHECK_CHAR") == "true",
+	})
+	if err != nil {
+		log.Fatalf("Error create key codec: %v", err)
+	}
+
+	var randomKeyLength int
+	if v := os.Getenv("SHORTLINK_RANDOM_KEY_LENGTH"); v != "" {
+		randomKeyLength, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid SHORTLINK_RANDOM_KEY_LENGTH: %v", err)
+		}
+	}
+
+	var blocklist *shortner.Blocklist
+	if path := os.Getenv("BLOCKLIST_FILE"); path != "" {
+		blocklist, err = shortner.LoadBlocklist(path)
+		if err != nil {
+			log.Fatalf("Error load blocklist: %v", err)
+		}
+	}
+
+	var visitFlushInterval time.Duration
+	if v := os.Getenv("VISITS_FLUSH_INTERVAL"); v != "" {
+		visitFlushInterval, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid VISITS_FLUSH_INTERVAL: %v", err)
+		}
+	}
+	var visitFlushSize int
+	if v := os.Getenv("VISITS_FLUSH_SIZE"); v != "" {
+		visitFlushSize, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid VISITS_FLUSH_SIZE: %v", err)
+		}
+	}
+
+	shortnerClient, err := shortner.New(ctx, shortner.Config{
+		BaseURL:            os.Getenv("SHORTLINK_BASE_URL"),
+		KeySecret:          os.Getenv("SHORTLINK_KEY_SECRET"),
+		Codec:              codec,
+		RandomKeyLength:    randomKeyLength,
+		Blocklist:          blocklist,
+		StrictVisits:       os.Getenv("VISITS_STRICT") == "true",
+		VisitFlushInterval: visitFlushInterval,
+		VisitFlushSize:     visitFlushSize,
+	}, dbClient)
 	if err != nil {
 		log.Fatalf("Error create shortner client: %v", err)
 	}
 
+	if len(os.Args) > 1 {
+		err = runCommand(ctx, shortnerClient, os.Args[1:])
+		if err != nil {
+			log.Fatalf("Error %s: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	deletedRetention := defaultDeletedRetention
+	if v := os.Getenv("DELETED_RETENTION"); v != "" {
+		deletedRetention, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid DELETED_RETENTION: %v", err)
+		}
+	}
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Timeout(60 * time.Second))
 
-	_, err = server.New(ctx, shortnerClient, r)
+	_, err = server.New(ctx, shortnerClient, r, server.Config{
+		ErrorFormat:      os.Getenv("ERROR_FORMAT"),
+		ErrorTemplate:    os.Getenv("ERROR_TEMPLATE"),
+		DeletedRetention: deletedRetention,
+		AdminToken:       os.Getenv("ADMIN_TOKEN"),
+	})
 	if err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	stopped := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		shutdownCtx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+		defer cancel()
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+		close(stopped)
+	}()
+
+	err = srv.ListenAndServe()
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
+
+	// the visits of the last requests are still buffered
+	err = shortnerClient.Close(ctx)
+	if err != nil {
+		log.Fatalf("Error flushing visits: %v", err)
+	}
+}
+
+// newDbClient creates the storage backend chosen by DB_BACKEND, mongo by default.
+func newDbClient(ctx context.Context) (shortner.DbClient, error) {
+	expiredRetention := defaultExpiredRetention
+	if v := os.Getenv("EXPIRED_RETENTION"); v != "" {
+		var err error
+		expiredRetention, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EXPIRED_RETENTION: %w", err)
+		}
+		if expiredRetention < 0 {
+			return nil, fmt.Errorf("invalid EXPIRED_RETENTION: %s is negative", v)
+		}
+	}
+
+	switch backend := os.Getenv("DB_BACKEND"); backend {
+	case "", "mongo":
+		var idBlockSize int
+		if v := os.Getenv("MONGO_ID_BLOCK_SIZE"); v != "" {
+			var err error
+			idBlockSize, err = strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid MONGO_ID_BLOCK_SIZE: %w", err)
+			}
+		}
+		return dbmongo.New(ctx, dbmongo.Config{
+			URI:              os.Getenv("MONGO_URI"),
+			DbName:           os.Getenv("MONGO_DB"),
+			ItemsCollName:    os.Getenv("MONGO_COLLECTION"),
+			IDBlockSize:      idBlockSize,
+			ExpiredRetention: expiredRetention,
+		})
+	case "memory":
+		var snapshotInterval time.Duration
+		if v := os.Getenv("MEMORY_SNAPSHOT_INTERVAL"); v != "" {
+			var err error
+			snapshotInterval, err = time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid MEMORY_SNAPSHOT_INTERVAL: %w", err)
+			}
+		}
+		dbClient, err := dbmemory.New(ctx, dbmemory.Config{
+			Dir:              os.Getenv("MEMORY_DIR"),
+			SnapshotInterval: snapshotInterval,
+			SyncWrites:       os.Getenv("MEMORY_SYNC") == "true",
+		})
+		if err != nil {
+			return nil, err
+		}
+		dbClient.StartSweeper(ctx, time.Minute, expiredRetention)
+		return dbClient, nil
+	case "bolt":
+		path := os.Getenv("BOLT_PATH")
+		if path == "" {
+			path = defaultBoltPath
+		}
+		dbClient, err := dbbolt.New(ctx, dbbolt.Config{Path: path})
+		if err != nil {
+			return nil, err
+		}
+		dbClient.StartSweeper(ctx, time.Minute, expiredRetention)
+		return dbClient, nil
+	case "sqlite", "postgres":
+		driver := dbsql.DriverPostgres
+		if backend == "sqlite" {
+			driver = dbsql.DriverSQLite
+		}
+		dbClient, err := dbsql.New(ctx, dbsql.Config{Driver: driver, DSN: os.Getenv("SQL_DSN")})
+		if err != nil {
+			return nil, err
+		}
+		dbClient.StartSweeper(ctx, time.Minute, expiredRetention)
+		return dbClient, nil
+	default:
+		return nil, fmt.Errorf("unknown DB_BACKEND %s", backend)
+	}
+}
+
+// newCache wraps dbClient with a cache configured by CACHE_SIZE, CACHE_TTL and CACHE_NEGATIVE_TTL.
+func newCache(ctx context.Context, dbClient shortner.DbClient) (shortner.DbClient, error) {
+	var config dbcache.Config
+	var err error
+	if v := os.Getenv("CACHE_SIZE"); v != "" {
+		config.Size, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CACHE_SIZE: %w", err)
+		}
+	}
+	if v := os.Getenv("CACHE_TTL"); v != "" {
+		config.TTL, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CACHE_TTL: %w", err)
+		}
+	}
+	if v := os.Getenv("CACHE_NEGATIVE_TTL"); v != "" {
+		config.NegativeTTL, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CACHE_NEGATIVE_TTL: %w", err)
+		}
+	}
+
+	cache, err := dbcache.New(dbClient, config)
+	if err != nil {
+		return nil, err
+	}
+	cache.StartReporter(ctx, time.Minute)
+	return cache, nil
 }
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"shortlink-service/shortlink"
+	"shortlink-service/shortner"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requireAdmin lets through the requests with the admin token as bearer token.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.writeError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminLinksHandler lists the shortlinks, deleted ones included, matching
+// the filters of the query params:
+//
+//	domain                 host of a redirect URL
+//	createdFrom, createdTo RFC 3339 creation time range, to exclusive
+//	minVisits, maxVisits   visit count range, inclusive
+//	keyType                standard, uuid, custom or random
+//	state                  active or deleted
+//	sort                   key (default), createdAt or visits, - prefix for descending
+//	offset, limit          page of the results, limit is 50 by default
+func (s *Server) AdminLinksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var verr *shortner.ValidationError
+	q, err := parseQuery(r.URL.Query())
+	if errors.As(err, &verr) {
+		writeJSON(w, http.StatusBadRequest, verr)
+		return
+	}
+
+	res, err := s.shortnerClient.QueryShortLinks(ctx, q)
+	if errors.As(err, &verr) {
+		writeJSON(w, http.StatusBadRequest, verr)
+		return
+	}
+	if err != nil {
+		s.writeLookupError(w, "querying shortlinks", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// parseQuery reads the query params of AdminLinksHandler, the malformed ones
+// are listed in a *shortner.ValidationError like the invalid ones.
+func parseQuery(values url.Values) (*shortlink.Query, error) {
+	q := shortlink.Query{
+		Domain:  values.Get("domain"),
+		KeyType: shortlink.KeyType(values.Get("keyType")),
+	}
+	verr := &shortner.ValidationError{}
+	invalid := func(field string) {
+		verr.Errors = append(verr.Errors, shortner.FieldError{Field: field, Message: "is malformed"})
+	}
+	var ok bool
+	if q.CreatedFrom, ok = parseTimeParam(values, "createdFrom"); !ok {
+		invalid("createdFrom")
+	}
+	if q.CreatedTo, ok = parseTimeParam(values, "createdTo"); !ok {
+		invalid("createdTo")
+	}
+	if q.MinVisits, ok = parseIntParam(values, "minVisits"); !ok {
+		invalid("minVisits")
+	}
+	if q.MaxVisits, ok = parseIntParam(values, "maxVisits"); !ok {
+		invalid("maxVisits")
+	}
+	if offset, ok := parseIntParam(values, "offset"); !ok {
+		invalid("offset")
+	} else if offset != nil {
+		q.Offset = *offset
+	}
+	if limit, ok := parseIntParam(values, "limit"); !ok {
+		invalid("limit")
+	} else if limit != nil {
+		q.Limit = *limit
+	}
+
+	switch values.Get("state") {
+	case "":
+	case "active":
+		state := shortlink.StateActive
+		q.State = &state
+	case "deleted":
+		state := shortlink.StateDeleted
+		q.State = &state
+	default:
+		verr.Errors = append(verr.Errors, shortner.FieldError{Field: "state", Message: "must be active or deleted"})
+	}
+	if len(verr.Errors) > 0 {
+		return nil, verr
+	}
+
+	sort := values.Get("sort")
+	if strings.HasPrefix(sort, "-") {
+		q.Desc = true
+		sort = sort[1:]
+	}
+	q.SortBy = shortlink.SortField(sort)
+	return &q, nil
+}
+
+// parseTimeParam returns the RFC 3339 time of the param, nil if it is not set
+// and false if it is malformed.
+func parseTimeParam(values url.Values, name string) (*time.Time, bool) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, false
+	}
+	return &t, true
+}
+
+// parseIntParam returns the integer of the param, nil if it is not set and
+// false if it is malformed.
+func parseIntParam(values url.Values, name string) (*int, bool) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, false
+	}
+	return &n, true
+}
+
+// ExportHandler streams every shortlink, deleted ones included, as NDJSON.
+func (s *Server) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	n, err := s.shortnerClient.ExportShortLinks(ctx, w)
+	if err != nil {
+		// the status is sent already, the cut off body is the only sign of the error
+		fmt.Printf("error exporting shortlinks after %d items: %v\n", n, err)
+	}
+}
+
+type importResult struct {
+	Imported int    `json:"imported"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportHandler stores the NDJSON shortlinks of the body under their keys.
+// On an error the response holds the number of items imported before it.
+func (s *Server) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	n, err := s.shortnerClient.ImportShortLinks(ctx, r.Body)
+	if errors.Is(err, shortner.ErrInvalidInput) {
+		writeJSON(w, http.StatusBadRequest, importResult{Imported: n, Error: err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Printf("error importing shortlinks: %v\n", err)
+		writeJSON(w, http.StatusInternalServerError, importResult{Imported: n, Error: "error importing shortlinks"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, importResult{Imported: n})
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"shortlink-service/shortner"
+)
+
+const (
+	ErrorFormatText = "text"
+	ErrorFormatJSON = "json"
+	ErrorFormatHTML = "html"
+)
+
+const defaultErrorTemplate = `<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.StatusText}}</title></head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`
+
+type errorPage struct {
+	Status     int    `json:"status"`
+	StatusText string `json:"-"`
+	Message    string `json:"error"`
+}
+
+func loadErrorTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return template.New("error").Parse(defaultErrorTemplate)
+	}
+	return template.ParseFiles(path)
+}
+
+// statusForError maps the shortner errors of a key lookup to a status code and message.
+func statusForError(err error) (int, string) {
+	switch {
+	case errors.Is(err, shortner.ErrInvalidKey):
+		return http.StatusBadRequest, "invalid shortlink"
+	case errors.Is(err, shortner.ErrNotFound):
+		return http.StatusNotFound, "shortlink not found"
+	case errors.Is(err, shortner.ErrDeleted):
+		return http.StatusGone, "shortlink was deleted"
+	case errors.Is(err, shortner.ErrExpired):
+		return http.StatusGone, "shortlink expired"
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
+}
+
+// writeError writes an error response in the configured error format.
+func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
+	page := errorPage{Status: status, StatusText: http.StatusText(status), Message: message}
+
+	switch s.config.ErrorFormat {
+	case ErrorFormatJSON:
+		writeJSON(w, status, page)
+	case ErrorFormatHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		err := s.errorTemplate.Execute(w, page)
+		if err != nil {
+			fmt.Printf("error rendering error page: %v\n", err)
+		}
+	default:
+		http.Error(w, message, status)
+	}
+}
+
+// writeLookupError logs unexpected errors and writes the error response of a key lookup.
+func (s *Server) writeLookupError(w http.ResponseWriter, what string, err error) {
+	status, message := statusForError(err)
+	if status == http.StatusInternalServerError {
+		fmt.Printf("error %s: %v\n", what, err)
+		message = "error " + what
+	}
+	s.writeError(w, status, message)
+}
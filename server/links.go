@@ -0,0 +1,257 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+	"shortlink-service/shortlink"
+	"shortlink-service/shortner"
+	"strconv"
+	"strings"
+)
+
+// authorHeader names the editor of a shortlink in its revision history.
+const authorHeader = "X-Author"
+
+func (s *Server) ShortlinkInfoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := chi.URLParam(r, "shortlink")
+
+	item, err := s.shortnerClient.GetShortLink(ctx, key)
+	if err != nil {
+		s.writeLookupError(w, "getting shortlink", err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(item.Version))
+	writeJSON(w, http.StatusOK, item)
+}
+
+// ShortlinkUpdateHandler replaces a shortlink with the body (PUT), or merges
+// the body into it (PATCH). The If-Match header must hold the ETag of the
+// version the update is based on.
+func (s *Server) ShortlinkUpdateHandler(patch bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		key := chi.URLParam(r, "shortlink")
+
+		ifMatch := r.Header.Get("If-Match")
+		if ifMatch == "" {
+			http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+			return
+		}
+		version, err := parseETag(ifMatch)
+		if err != nil {
+			http.Error(w, "invalid If-Match header", http.StatusBadRequest)
+			return
+		}
+
+		var current *shortlink.Item
+		if patch {
+			current, err = s.shortnerClient.GetShortLink(ctx, key)
+			if err != nil {
+				s.writeLookupError(w, "getting shortlink", err)
+				return
+			}
+		}
+
+		defer r.Body.Close()
+		in, err := decodeUpdate(r.Body, current)
+		if err != nil {
+			fmt.Printf("error decode shortlink: %v\n", err)
+			http.Error(w, "failed to decode body", http.StatusBadRequest)
+			return
+		}
+		in.Author = r.Header.Get(authorHeader)
+
+		item, err := s.shortnerClient.UpdateShortLink(ctx, key, in, version)
+		if errors.Is(err, shortner.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		}
+		var verr *shortner.ValidationError
+		if errors.As(err, &verr) {
+			writeJSON(w, http.StatusBadRequest, verr)
+			return
+		}
+		if err != nil {
+			s.writeLookupError(w, "updating shortlink", err)
+			return
+		}
+
+		w.Header().Set("ETag", etag(item.Version))
+		writeJSON(w, http.StatusOK, item)
+	}
+}
+
+// decodeUpdate decodes the body of an update. For a PATCH the fields missing
+// from the body keep their current values, a ttl replaces the current expiry.
+// The body is decoded into a new input, the current item is shared with the
+// storage and must not be written to.
+func decodeUpdate(body io.Reader, current *shortlink.Item) (*shortlink.Input, error) {
+	var raw json.RawMessage
+	err := json.NewDecoder(body).Decode(&raw)
+	if err != nil {
+		return nil, err
+	}
+	var in shortlink.Input
+	err = json.Unmarshal(raw, &in)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return &in, nil
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(raw, &fields)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fields["redirects"]; !ok {
+		in.Redirects = current.Redirects
+	}
+	if _, ok := fields["timezone"]; !ok {
+		in.Timezone = current.Timezone
+	}
+	if _, ok := fields["expiresAt"]; !ok && in.TTL == 0 {
+		in.ExpiresAt = current.ExpiresAt
+	}
+	return &in, nil
+}
+
+func (s *Server) RevisionsListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := chi.URLParam(r, "shortlink")
+
+	revs, err := s.shortnerClient.ListRevisions(ctx, key)
+	if err != nil {
+		s.writeLookupError(w, "listing revisions", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, revs)
+}
+
+// RevisionsDiffHandler serves the diff between the revisions given by the from and to query params.
+func (s *Server) RevisionsDiffHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := chi.URLParam(r, "shortlink")
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "invalid from version", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "invalid to version", http.StatusBadRequest)
+		return
+	}
+
+	diff, err := s.shortnerClient.DiffRevisions(ctx, key, from, to)
+	if errors.Is(err, shortner.ErrInvalidInput) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.writeLookupError(w, "diffing revisions", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, diff)
+}
+
+// RevisionRollbackHandler restores the redirects of a revision. Like an
+// update, it requires the If-Match header with the current ETag.
+func (s *Server) RevisionRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := chi.URLParam(r, "shortlink")
+
+	toVersion, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		http.Error(w, "invalid version", http.StatusBadRequest)
+		return
+	}
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+		return
+	}
+	version, err := parseETag(ifMatch)
+	if err != nil {
+		http.Error(w, "invalid If-Match header", http.StatusBadRequest)
+		return
+	}
+
+	item, err := s.shortnerClient.RollbackShortLink(ctx, key, toVersion, version, r.Header.Get(authorHeader))
+	if errors.Is(err, shortner.ErrVersionConflict) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, shortner.ErrInvalidInput) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.writeLookupError(w, "rolling back shortlink", err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(item.Version))
+	writeJSON(w, http.StatusOK, item)
+}
+
+// DeletedListHandler lists the deleted shortlinks with their public keys, as used by DeletedRestoreHandler.
+func (s *Server) DeletedListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	items, err := s.shortnerClient.ListDeletedShortLinks(ctx)
+	if err != nil {
+		s.writeLookupError(w, "listing deleted shortlinks", err)
+		return
+	}
+	if items == nil {
+		items = []*shortlink.Item{}
+	}
+
+	writeJSON(w, http.StatusOK, items)
+}
+
+func (s *Server) DeletedRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := chi.URLParam(r, "key")
+
+	err := s.shortnerClient.RestoreShortLink(ctx, key)
+	if err != nil {
+		s.writeLookupError(w, "restoring shortlink", err)
+		return
+	}
+
+	w.Write([]byte("ok"))
+}
+
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+func parseETag(value string) (int, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+	return strconv.Atoi(strings.Trim(value, `"`))
+}
+
+// BlockedListHandler lists the existing shortlinks whose key is blocked by the current blocklist.
+func (s *Server) BlockedListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	items, err := s.shortnerClient.BlockedShortLinks(ctx)
+	if err != nil {
+		s.writeLookupError(w, "listing blocked shortlinks", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, items)
+}
@@ -3,36 +3,106 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"html/template"
+	"io"
 	"net/http"
-	"net/url"
 	"shortlink-service/shortlink"
+	"shortlink-service/shortner"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+type Config struct {
+	// ErrorFormat is one of ErrorFormatText (default), ErrorFormatJSON or ErrorFormatHTML.
+	ErrorFormat string
+	// ErrorTemplate is an optional html/template file for ErrorFormatHTML,
+	// executed with the Status, StatusText and Message of the error.
+	ErrorTemplate string
+	// DeletedRetention is how long deleted shortlinks are kept before /cron/purgeDeleted removes them.
+	DeletedRetention time.Duration
+	// AdminToken is the bearer token of the /s/admin endpoints, they are
+	// not served if empty.
+	AdminToken string
+}
+
 type Server struct {
 	shortnerClient ShortnerClient
+	config         Config
+	errorTemplate  *template.Template
 }
 
 type ShortnerClient interface {
 	GenerateShortLink(ctx context.Context, data *shortlink.Input) (string, error)
-	GetLongURL(ctx context.Context, key string, t time.Time, kt shortlink.KeyType, incVisits bool) (string, error)
-	GelAllShortLinks(ctx context.Context) ([]*shortlink.Item, error)
+	GetLongURL(ctx context.Context, key string, t time.Time, incVisits bool) (string, error)
+	GetShortLink(ctx context.Context, key string) (*shortlink.Item, error)
+	UpdateShortLink(ctx context.Context, key string, data *shortlink.Input, version int) (*shortlink.Item, error)
+	ListRevisions(ctx context.Context, key string) ([]*shortlink.Revision, error)
+	DiffRevisions(ctx context.Context, key string, from, to int) (*shortlink.RevisionDiff, error)
+	RollbackShortLink(ctx context.Context, key string, toVersion, version int, author string) (*shortlink.Item, error)
+	EachShortLink(ctx context.Context, fn func(item *shortlink.Item) error) error
 	DeleteShortLink(ctx context.Context, key string) error
+	ListDeletedShortLinks(ctx context.Context) ([]*shortlink.Item, error)
+	RestoreShortLink(ctx context.Context, key string) error
+	PurgeDeletedShortLinks(ctx context.Context, retention time.Duration) (int, error)
+	BlockedShortLinks(ctx context.Context) ([]*shortlink.Item, error)
+	QueryShortLinks(ctx context.Context, q *shortlink.Query) (*shortlink.QueryResult, error)
+	ExportShortLinks(ctx context.Context, w io.Writer) (int, error)
+	ImportShortLinks(ctx context.Context, r io.Reader) (int, error)
 }
 
-func New(ctx context.Context, shortnerClient ShortnerClient, router chi.Router) (*Server, error) {
-	s := Server{shortnerClient: shortnerClient}
+func New(ctx context.Context, shortnerClient ShortnerClient, router chi.Router, config Config) (*Server, error) {
+	switch config.ErrorFormat {
+	case "", ErrorFormatText, ErrorFormatJSON, ErrorFormatHTML:
+	default:
+		return nil, fmt.Errorf("unknown error format %s", config.ErrorFormat)
+	}
+	errorTemplate, err := loadErrorTemplate(config.ErrorTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Server{shortnerClient: shortnerClient, config: config, errorTemplate: errorTemplate}
 	router.Post("/s/generate", s.ShortlinkGenerateHandler)
-	router.Get("/{shortlink}", s.ShortlinkRedirectHandler(shortlink.KeyTypeStandard))
-	router.Get("/u/{shortlink}", s.ShortlinkRedirectHandler(shortlink.KeyTypeUuid))
+	s.keyRoutes(router, "")
+	// uuid links used to be served under /u/, keep the old printed links working
+	s.keyRoutes(router, "/u")
 	router.Get("/cron/checkRedirects", s.CheckRedirectsHandler)
+	if config.AdminToken != "" {
+		router.Group(func(admin chi.Router) {
+			admin.Use(s.requireAdmin)
+			// the ETag of a link is public, it doesn't stop others from changing it
+			s.updateRoutes(admin, "")
+			s.updateRoutes(admin, "/u")
+			admin.Get("/s/deleted", s.DeletedListHandler)
+			admin.Post("/s/deleted/{key}/restore", s.DeletedRestoreHandler)
+			admin.Get("/s/blocked", s.BlockedListHandler)
+			admin.Get("/cron/purgeDeleted", s.PurgeDeletedHandler)
+			admin.Get("/s/admin/links", s.AdminLinksHandler)
+			admin.Get("/s/admin/export", s.ExportHandler)
+			admin.Post("/s/admin/import", s.ImportHandler)
+		})
+	}
 	return &s, nil
 }
 
+func (s *Server) keyRoutes(router chi.Router, prefix string) {
+	router.Get(prefix+"/{shortlink}", s.ShortlinkRedirectHandler)
+	router.Get(prefix+"/{shortlink}/info", s.ShortlinkInfoHandler)
+	router.Get(prefix+"/{shortlink}/revisions", s.RevisionsListHandler)
+	router.Get(prefix+"/{shortlink}/revisions/diff", s.RevisionsDiffHandler)
+}
+
+// updateRoutes registers the routes changing a shortlink, they are admin routes.
+func (s *Server) updateRoutes(router chi.Router, prefix string) {
+	router.Put(prefix+"/{shortlink}", s.ShortlinkUpdateHandler(false))
+	router.Patch(prefix+"/{shortlink}", s.ShortlinkUpdateHandler(true))
+	router.Post(prefix+"/{shortlink}/revisions/{version}/rollback", s.RevisionRollbackHandler)
+}
+
 func (s *Server) ShortlinkGenerateHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	var in shortlink.Input
@@ -44,14 +114,22 @@ func (s *Server) ShortlinkGenerateHandler(w http.ResponseWriter, r *http.Request
 		http.Error(w, "failed to decode body", http.StatusBadRequest)
 		return
 	}
+	in.Author = r.Header.Get(authorHeader)
 
-	err = validateURLs(in)
-	if err != nil {
+	shortLink, err := s.shortnerClient.GenerateShortLink(ctx, &in)
+	if errors.Is(err, shortner.ErrKeyExists) {
+		http.Error(w, fmt.Sprintf("alias %s is already taken", in.Alias), http.StatusConflict)
+		return
+	}
+	var verr *shortner.ValidationError
+	if errors.As(err, &verr) {
+		writeJSON(w, http.StatusBadRequest, verr)
+		return
+	}
+	if errors.Is(err, shortner.ErrInvalidInput) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	shortLink, err := s.shortnerClient.GenerateShortLink(ctx, &in)
 	if err != nil {
 		fmt.Printf("error generating url: %v\n", err)
 		http.Error(w, "error generating url", http.StatusInternalServerError)
@@ -61,21 +139,18 @@ func (s *Server) ShortlinkGenerateHandler(w http.ResponseWriter, r *http.Request
 	w.Write([]byte(fmt.Sprint(shortLink)))
 }
 
-func (s *Server) ShortlinkRedirectHandler(keyType shortlink.KeyType) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		key := chi.URLParam(r, "shortlink")
-
-		redirectUrl, err := s.shortnerClient.GetLongURL(ctx, key, time.Now(), keyType, true)
-		if err != nil {
-			fmt.Printf("error getting url by uuid: %v\n", err)
-			http.Error(w, "error getting url", http.StatusInternalServerError)
-			return
-		}
+func (s *Server) ShortlinkRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := chi.URLParam(r, "shortlink")
 
-		http.Redirect(w, r, redirectUrl, http.StatusFound)
+	redirectUrl, err := s.shortnerClient.GetLongURL(ctx, key, time.Now(), true)
+	if err != nil {
+		s.writeLookupError(w, "getting url", err)
 		return
 	}
+
+	http.Redirect(w, r, redirectUrl, http.StatusFound)
+	return
 }
 
 func (s *Server) CheckRedirectsHandler(w http.ResponseWriter, r *http.Request) {
@@ -90,22 +165,28 @@ func (s *Server) CheckRedirectsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(fmt.Sprint("ok")))
 }
 
-func (s *Server) CheckRedirects(ctx context.Context) error {
-	defer elapsed("CheckRedirects()")()
-	items, err := s.shortnerClient.GelAllShortLinks(ctx)
+func (s *Server) PurgeDeletedHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	purged, err := s.shortnerClient.PurgeDeletedShortLinks(ctx, s.config.DeletedRetention)
 	if err != nil {
-		return err
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	numJobs := len(items)
-	itemJobs := make(chan *shortlink.Item, numJobs)
+	w.Write([]byte(fmt.Sprintf("purged %d", purged)))
+}
+
+func (s *Server) CheckRedirects(ctx context.Context) error {
+	defer elapsed("CheckRedirects()")()
 	workers := 1000
+	itemJobs := make(chan *shortlink.Item, workers)
 	hc := &http.Client{Timeout: 10 * time.Second}
 	wg := sync.WaitGroup{}
 	wg.Add(workers)
-	var doneCount uint64
+	var doneCount, queuedCount uint64
 
-	go backgroundTask(ctx, numJobs+1, &doneCount)
+	go backgroundTask(ctx, &queuedCount, &doneCount)
 
 	for i := 0; i < workers; i++ {
 		go func(ctxI context.Context, wgI *sync.WaitGroup) {
@@ -133,14 +214,17 @@ func (s *Server) CheckRedirects(ctx context.Context) error {
 		}(ctx, &wg)
 	}
 
-	for _, item := range items {
+	// the links are streamed to the workers, so only a page of them is held in memory
+	err := s.shortnerClient.EachShortLink(ctx, func(item *shortlink.Item) error {
+		atomic.AddUint64(&queuedCount, 1)
 		itemJobs <- item
-	}
+		return nil
+	})
 	close(itemJobs)
 
 	wg.Wait()
 
-	return nil
+	return err
 }
 
 func (s *Server) urlCheckWorker(ctx context.Context, urlJobs <-chan string, hc *http.Client, itemKey string, wg *sync.WaitGroup) {
@@ -162,7 +246,7 @@ func (s *Server) urlCheckWorker(ctx context.Context, urlJobs <-chan string, hc *
 	}
 }
 
-func backgroundTask(ctx context.Context, total int, done *uint64) {
+func backgroundTask(ctx context.Context, total, done *uint64) {
 	ticker := time.NewTicker(10 * time.Second)
 	go func() {
 		for {
@@ -171,23 +255,19 @@ func backgroundTask(ctx context.Context, total int, done *uint64) {
 				ticker.Stop()
 				return
 			case _ = <-ticker.C:
-				fmt.Printf("progress (%d,%d)\n", atomic.LoadUint64(done), total)
+				fmt.Printf("progress (%d,%d)\n", atomic.LoadUint64(done), atomic.LoadUint64(total))
 			}
 		}
 	}()
 }
 
-func validateURLs(in shortlink.Input) error {
-	for i, r := range in.Redirects {
-		if r.URL == "" {
-			return fmt.Errorf("url not provided at index %d", i)
-		}
-		_, err := url.ParseRequestURI(r.URL)
-		if err != nil {
-			return err
-		}
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		fmt.Printf("error encoding response: %v\n", err)
 	}
-	return nil
 }
 
 func elapsed(what string) func() {
@@ -2,12 +2,16 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	db "shortlink-service/dbmemory"
 	"shortlink-service/shortlink"
 	"shortlink-service/shortner"
+	"strings"
 	"testing"
 	"time"
 )
@@ -15,12 +19,12 @@ import (
 func TestServer(t *testing.T) {
 	ctx := context.Background()
 
-	dbClient, err := db.New(ctx)
+	dbClient, err := db.New(ctx, db.Config{})
 	if err != nil {
 		log.Fatalf("Error create db client: %v", err)
 	}
 
-	shortnerClient, err := shortner.New(ctx, "http://localhost:8080", dbClient)
+	shortnerClient, err := shortner.New(ctx, shortner.Config{BaseURL: "http://localhost:8080"}, dbClient)
 	if err != nil {
 		log.Fatalf("Error create shortner client: %v", err)
 	}
@@ -46,7 +50,7 @@ func TestServer(t *testing.T) {
 			KeyType: shortlink.KeyTypeUuid,
 			Redirects: []shortlink.Redirect{
 				{From: 0, To: 8, URL: "https://www.yahoo.com"},
-				{From: 8, To: 21, URL: "https://pkg.go.dev/blablabla"},
+				{From: 8, To: 24, URL: "https://pkg.go.dev/blablabla"},
 			},
 		},
 	}
@@ -62,7 +66,7 @@ func TestServer(t *testing.T) {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Timeout(60 * time.Second))
 
-	s, err := New(ctx, shortnerClient, r)
+	s, err := New(ctx, shortnerClient, r, Config{})
 	if err != nil {
 		log.Fatalf("failed to start server: %v", err)
 	}
@@ -73,3 +77,532 @@ func TestServer(t *testing.T) {
 	}
 
 }
+
+func TestServer_ShortlinkGenerateHandler(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := db.New(ctx, db.Config{})
+	if err != nil {
+		t.Fatalf("Error create db client: %v", err)
+	}
+
+	shortnerClient, err := shortner.New(ctx, shortner.Config{BaseURL: "http://localhost:8080"}, dbClient)
+	if err != nil {
+		t.Fatalf("Error create shortner client: %v", err)
+	}
+
+	r := chi.NewRouter()
+	_, err = New(ctx, shortnerClient, r, Config{})
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid alias", `{"alias":"spring-sale","redirects":[{"from":0,"to":24,"url":"https://google.com"}]}`, http.StatusOK},
+		{"taken alias", `{"alias":"spring-sale","redirects":[{"from":0,"to":24,"url":"https://google.com"}]}`, http.StatusConflict},
+		{"invalid body", `{"redirects":`, http.StatusBadRequest},
+		{"invalid redirects", `{"redirects":[{"from":0,"to":12,"url":"https://google.com"}]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/s/generate", strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status mismatch. expected: %d, got: %d (%s)", tt.name, tt.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/s/generate", strings.NewReader(tests[3].body))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var verr shortner.ValidationError
+	err = json.NewDecoder(rec.Body).Decode(&verr)
+	if err != nil {
+		t.Fatalf("failed to decode validation error: %v", err)
+	}
+	if len(verr.Errors) != 1 || verr.Errors[0].Field != "redirects" {
+		t.Errorf("unexpected validation errors: %v", verr.Errors)
+	}
+}
+
+func TestServer_ShortlinkUpdateHandler(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := db.New(ctx, db.Config{})
+	if err != nil {
+		t.Fatalf("Error create db client: %v", err)
+	}
+
+	shortnerClient, err := shortner.New(ctx, shortner.Config{BaseURL: "http://localhost:8080"}, dbClient)
+	if err != nil {
+		t.Fatalf("Error create shortner client: %v", err)
+	}
+
+	r := chi.NewRouter()
+	_, err = New(ctx, shortnerClient, r, Config{AdminToken: "token"})
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType:   shortlink.KeyTypeUuid,
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	}
+	sl, err := shortnerClient.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("failed to create shortlink: %v", err)
+	}
+	path := strings.TrimPrefix(sl, "http://localhost:8080")
+
+	body := `{"redirects":[{"from":0,"to":24,"url":"https://youtube.com"}]}`
+	tests := []struct {
+		name    string
+		method  string
+		ifMatch string
+		status  int
+		etag    string
+	}{
+		{"missing if-match", http.MethodPut, "", http.StatusPreconditionRequired, ""},
+		{"put", http.MethodPut, `"1"`, http.StatusOK, `"2"`},
+		{"stale put", http.MethodPut, `"1"`, http.StatusPreconditionFailed, ""},
+		{"patch", http.MethodPatch, `"2"`, http.StatusOK, `"3"`},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token")
+		if tt.ifMatch != "" {
+			req.Header.Set("If-Match", tt.ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status mismatch. expected: %d, got: %d (%s)", tt.name, tt.status, rec.Code, rec.Body.String())
+		}
+		if etag := rec.Header().Get("ETag"); etag != tt.etag {
+			t.Errorf("%s: etag mismatch. expected: %s, got: %s", tt.name, tt.etag, etag)
+		}
+	}
+
+	t.Log("Testing updates and rollbacks require the admin token....")
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPut, path},
+		{http.MethodPatch, path},
+		{http.MethodPut, "/u" + path},
+		{http.MethodPatch, "/u" + path},
+		{http.MethodPost, path + "/revisions/1/rollback"},
+		{http.MethodPost, "/u" + path + "/revisions/1/rollback"},
+	} {
+		req := httptest.NewRequest(route.method, route.path, strings.NewReader(body))
+		req.Header.Set("If-Match", `"3"`)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: status mismatch. expected: %d, got: %d", route.method, route.path, http.StatusUnauthorized, rec.Code)
+		}
+	}
+
+	t.Log("Testing legacy /u/ links....")
+	req := httptest.NewRequest(http.MethodGet, "/u"+path+"/info", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"3"` {
+		t.Errorf("legacy link: unexpected response %d etag %s (%s)", rec.Code, rec.Header().Get("ETag"), rec.Body.String())
+	}
+
+	t.Log("Testing patches of the expiry....")
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	expiryTests := []struct {
+		name    string
+		method  string
+		ifMatch string
+		body    string
+		status  int
+	}{
+		{"put expiry", http.MethodPut, `"3"`, `{"redirects":[{"from":0,"to":24,"url":"https://youtube.com"}],"expiresAt":"` + expiresAt.Format(time.RFC3339) + `"}`, http.StatusOK},
+		{"stale patch expiry", http.MethodPatch, `"3"`, `{"expiresAt":"2099-01-01T00:00:00Z"}`, http.StatusPreconditionFailed},
+		{"invalid patch expiry", http.MethodPatch, `"4"`, `{"expiresAt":"2099-01-01T00:00:00Z","redirects":[]}`, http.StatusBadRequest},
+		{"patch ttl and expiry", http.MethodPatch, `"4"`, `{"ttl":60,"expiresAt":"2099-01-01T00:00:00Z"}`, http.StatusBadRequest},
+	}
+	for _, tt := range expiryTests {
+		req := httptest.NewRequest(tt.method, path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("If-Match", tt.ifMatch)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status mismatch. expected: %d, got: %d (%s)", tt.name, tt.status, rec.Code, rec.Body.String())
+		}
+
+		item, err := shortnerClient.GetShortLink(ctx, strings.TrimPrefix(path, "/"))
+		if err != nil {
+			t.Fatalf("%s: failed to get shortlink: %v", tt.name, err)
+		}
+		if item.ExpiresAt == nil || !item.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("%s: expiry mismatch. expected: %v, got: %v", tt.name, expiresAt, item.ExpiresAt)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"ttl":60}`))
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("If-Match", `"4"`)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var item shortlink.Item
+	err = json.NewDecoder(rec.Body).Decode(&item)
+	if err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("patch ttl: unexpected response %d: %v", rec.Code, err)
+	}
+	if item.ExpiresAt == nil || !item.ExpiresAt.Before(expiresAt) || len(item.Redirects) != 1 {
+		t.Errorf("patch ttl: expected a new expiry within a minute and the current redirects, got: %+v", item)
+	}
+
+	t.Log("Testing rollbacks with the admin token....")
+	req = httptest.NewRequest(http.MethodPost, path+"/revisions/1/rollback", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("If-Match", `"5"`)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	item = shortlink.Item{}
+	err = json.NewDecoder(rec.Body).Decode(&item)
+	if err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("rollback: unexpected response %d: %v", rec.Code, err)
+	}
+	if item.Version != 6 || item.Redirects[0].URL != "https://google.com" {
+		t.Errorf("rollback: expected the redirects of version 1 as version 6, got: %+v", item)
+	}
+}
+
+func TestServer_ShortlinkRedirectHandlerErrors(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := db.New(ctx, db.Config{})
+	if err != nil {
+		t.Fatalf("Error create db client: %v", err)
+	}
+
+	shortnerClient, err := shortner.New(ctx, shortner.Config{BaseURL: "http://localhost:8080"}, dbClient)
+	if err != nil {
+		t.Fatalf("Error create shortner client: %v", err)
+	}
+
+	r := chi.NewRouter()
+	_, err = New(ctx, shortnerClient, r, Config{ErrorFormat: ErrorFormatJSON})
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType:   shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+		TTL:       1,
+	}
+	sl, err := shortnerClient.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("failed to create shortlink: %v", err)
+	}
+	time.Sleep(time.Second)
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"invalid key", "/not-base62", http.StatusBadRequest},
+		{"legacy prefix", "/u/not-base62", http.StatusBadRequest},
+		{"unknown key", "/zzz", http.StatusNotFound},
+		{"expired key", strings.TrimPrefix(sl, "http://localhost:8080"), http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status mismatch. expected: %d, got: %d (%s)", tt.name, tt.status, rec.Code, rec.Body.String())
+			continue
+		}
+
+		var page struct {
+			Status int    `json:"status"`
+			Error  string `json:"error"`
+		}
+		err := json.NewDecoder(rec.Body).Decode(&page)
+		if err != nil || page.Status != tt.status || page.Error == "" {
+			t.Errorf("%s: unexpected error page: %+v (%v)", tt.name, page, err)
+		}
+	}
+}
+
+func TestServer_AdminLinksHandler(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := db.New(ctx, db.Config{})
+	if err != nil {
+		t.Fatalf("Error create db client: %v", err)
+	}
+
+	shortnerClient, err := shortner.New(ctx, shortner.Config{BaseURL: "http://localhost:8080"}, dbClient)
+	if err != nil {
+		t.Fatalf("Error create shortner client: %v", err)
+	}
+
+	r := chi.NewRouter()
+	_, err = New(ctx, shortnerClient, r, Config{AdminToken: "token"})
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	for _, url := range []string{"https://google.com", "https://youtube.com", "https://google.com/maps"} {
+		input := shortlink.Input{Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: url}}}
+		if _, err := shortnerClient.GenerateShortLink(ctx, &input); err != nil {
+			t.Fatalf("failed to create shortlink: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+		total  int
+	}{
+		{"no token", "/s/admin/links", "", http.StatusUnauthorized, 0},
+		{"wrong token", "/s/admin/links", "secret", http.StatusUnauthorized, 0},
+		{"all", "/s/admin/links", "token", http.StatusOK, 3},
+		{"filtered", "/s/admin/links?domain=google.com&state=active&sort=-createdAt&limit=1", "token", http.StatusOK, 2},
+		{"invalid param", "/s/admin/links?minVisits=many", "token", http.StatusBadRequest, 0},
+		{"invalid query", "/s/admin/links?sort=url", "token", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status mismatch. expected: %d, got: %d (%s)", tt.name, tt.status, rec.Code, rec.Body.String())
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var res shortlink.QueryResult
+		err := json.NewDecoder(rec.Body).Decode(&res)
+		if err != nil || res.Total != tt.total {
+			t.Errorf("%s: unexpected result: %+v (%v)", tt.name, res, err)
+		}
+	}
+
+	t.Log("Testing malformed params are validation errors....")
+	req := httptest.NewRequest(http.MethodGet, "/s/admin/links?minVisits=many&createdTo=today&state=gone", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var verr shortner.ValidationError
+	err = json.NewDecoder(rec.Body).Decode(&verr)
+	if err != nil || rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("malformed params: unexpected response %d: %v", rec.Code, err)
+	}
+	fields := make(map[string]bool)
+	for _, fe := range verr.Errors {
+		fields[fe.Field] = true
+	}
+	if len(verr.Errors) != 3 || !fields["minVisits"] || !fields["createdTo"] || !fields["state"] {
+		t.Errorf("unexpected validation errors: %v", verr.Errors)
+	}
+
+	t.Log("Testing the token requires the bearer scheme....")
+	for _, auth := range []string{"token", "Basic token"} {
+		req := httptest.NewRequest(http.MethodGet, "/s/admin/links", nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status mismatch. expected: %d, got: %d", auth, http.StatusUnauthorized, rec.Code)
+		}
+	}
+
+	t.Log("Testing the deletion and blocklist endpoints require the token....")
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/s/deleted"},
+		{http.MethodPost, "/s/deleted/missing/restore"},
+		{http.MethodGet, "/s/blocked"},
+		{http.MethodGet, "/cron/purgeDeleted"},
+	} {
+		req := httptest.NewRequest(route.method, route.path, nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: status mismatch. expected: %d, got: %d", route.method, route.path, http.StatusUnauthorized, rec.Code)
+		}
+
+		req = httptest.NewRequest(route.method, route.path, nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code == http.StatusUnauthorized {
+			t.Errorf("%s %s: rejected the admin token", route.method, route.path)
+		}
+	}
+
+	t.Log("Testing the admin endpoints are off without a token....")
+	r = chi.NewRouter()
+	_, err = New(ctx, shortnerClient, r, Config{})
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/s/admin/links", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK {
+		t.Errorf("admin endpoint served without a token: %s", rec.Body.String())
+	}
+}
+
+func TestServer_DeletedHandlers(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := db.New(ctx, db.Config{})
+	if err != nil {
+		t.Fatalf("Error create db client: %v", err)
+	}
+
+	shortnerClient, err := shortner.New(ctx, shortner.Config{BaseURL: "http://localhost:8080", KeySecret: "secret"}, dbClient)
+	if err != nil {
+		t.Fatalf("Error create shortner client: %v", err)
+	}
+
+	r := chi.NewRouter()
+	_, err = New(ctx, shortnerClient, r, Config{AdminToken: "token"})
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType:   shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	}
+	sl, err := shortnerClient.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("failed to create shortlink: %v", err)
+	}
+	path := strings.TrimPrefix(sl, "http://localhost:8080")
+	if err := shortnerClient.DeleteShortLink(ctx, "1"); err != nil {
+		t.Fatalf("failed to delete shortlink: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/s/deleted", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var deleted []*shortlink.Item
+	err = json.NewDecoder(rec.Body).Decode(&deleted)
+	if err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("list deleted: unexpected response %d: %v", rec.Code, err)
+	}
+	if len(deleted) != 1 || "/"+deleted[0].Key != path {
+		t.Fatalf("expected the deleted shortlink under %s, got: %+v", path, deleted)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/s/deleted/"+deleted[0].Key+"/restore", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore: status mismatch. expected: %d, got: %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, path, nil)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Errorf("restored shortlink doesn't redirect: %d (%s)", rec.Code, rec.Body.String())
+	}
+}
+
+func TestServer_ExportImportHandlers(t *testing.T) {
+	ctx := context.Background()
+
+	newRouter := func() (*chi.Mux, *shortner.Client) {
+		dbClient, err := db.New(ctx, db.Config{})
+		if err != nil {
+			t.Fatalf("Error create db client: %v", err)
+		}
+		shortnerClient, err := shortner.New(ctx, shortner.Config{BaseURL: "http://localhost:8080"}, dbClient)
+		if err != nil {
+			t.Fatalf("Error create shortner client: %v", err)
+		}
+		r := chi.NewRouter()
+		_, err = New(ctx, shortnerClient, r, Config{AdminToken: "token"})
+		if err != nil {
+			t.Fatalf("failed to start server: %v", err)
+		}
+		return r, shortnerClient
+	}
+	src, srcClient := newRouter()
+	input := shortlink.Input{Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}}}
+	sl, err := srcClient.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("failed to create shortlink: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/s/admin/export", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	src.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("unexpected export response: %d %s", rec.Code, rec.Body.String())
+	}
+	exported := rec.Body.String()
+
+	dst, _ := newRouter()
+	tests := []struct {
+		name     string
+		body     string
+		token    string
+		status   int
+		imported int
+	}{
+		{"no token", exported, "", http.StatusUnauthorized, 0},
+		{"valid", exported, "token", http.StatusOK, 1},
+		{"invalid", exported + `{"key":""}`, "token", http.StatusBadRequest, 1},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/s/admin/import", strings.NewReader(tt.body))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		dst.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status mismatch. expected: %d, got: %d (%s)", tt.name, tt.status, rec.Code, rec.Body.String())
+			continue
+		}
+		if rec.Code == http.StatusUnauthorized {
+			continue
+		}
+		var res struct {
+			Imported int `json:"imported"`
+		}
+		err := json.NewDecoder(rec.Body).Decode(&res)
+		if err != nil || res.Imported != tt.imported {
+			t.Errorf("%s: unexpected result: %+v (%v)", tt.name, res, err)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, strings.TrimPrefix(sl, "http://localhost:8080"), nil)
+	rec = httptest.NewRecorder()
+	dst.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Errorf("imported shortlink doesn't redirect: %d (%s)", rec.Code, rec.Body.String())
+	}
+}
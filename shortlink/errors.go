@@ -0,0 +1,33 @@
+package shortlink
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned by storage backends when a key is not exist.
+	ErrNotFound = errors.New("key is not exist")
+	// ErrDeleted is returned by storage backends when a key was deleted.
+	ErrDeleted = errors.New("key was deleted")
+	// ErrKeyExists is returned by storage backends when a key is already taken.
+	ErrKeyExists = errors.New("key already exist")
+	// ErrVersionConflict is returned by storage backends when an update is
+	// based on a version other than the stored one.
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+// VisitsError is returned by storage backends when the visits of only some
+// keys could not be added, the visits of the other keys were added.
+type VisitsError struct {
+	Keys []string
+	Err  error
+}
+
+func (e *VisitsError) Error() string {
+	return fmt.Sprintf("visits of %d keys not added: %v", len(e.Keys), e.Err)
+}
+
+func (e *VisitsError) Unwrap() error {
+	return e.Err
+}
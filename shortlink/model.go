@@ -1,25 +1,112 @@
 package shortlink
 
+import (
+	"fmt"
+	uuid "github.com/nu7hatch/gouuid"
+	"strconv"
+	"time"
+)
+
 type KeyType string
 
 const (
 	KeyTypeUuid     KeyType = "uuid"
 	KeyTypeStandard KeyType = "standard"
+	KeyTypeCustom   KeyType = "custom"
+	// KeyTypeRandom keys are random fixed-length base62 strings, stored under the key itself.
+	KeyTypeRandom KeyType = "random"
 )
 
+// State is the lifecycle state of an item, deleted items can be restored until they are purged.
+type State int
+
+const (
+	StateDeleted State = 0
+	StateActive  State = 1
+)
+
+// Redirect sends traffic to URL during the daily window From:FromMinute - To:ToMinute.
+// A window whose end is before its start wraps past midnight. Weekdays and the
+// StartDate - EndDate range (inclusive, 2006-01-02 format) limit the days the
+// window applies on; for a wrapping window that is the day it started.
 type Redirect struct {
-	From int    `json:"from"`
-	To   int    `json:"to"`
-	URL  string `json:"url"`
+	From       int            `json:"from"`
+	To         int            `json:"to"`
+	FromMinute int            `json:"fromMinute,omitempty"`
+	ToMinute   int            `json:"toMinute,omitempty"`
+	Weekdays   []time.Weekday `json:"weekdays,omitempty"`
+	StartDate  string         `json:"startDate,omitempty"`
+	EndDate    string         `json:"endDate,omitempty"`
+	URL        string         `json:"url"`
 }
 
 type Input struct {
 	KeyType   KeyType    `json:"keyType"`
+	Alias     string     `json:"alias,omitempty"`
 	Redirects []Redirect `json:"redirects"`
+	// Timezone is an IANA zone name the redirect windows are matched in, server local time if empty.
+	Timezone string `json:"timezone,omitempty"`
+	// ExpiresAt and TTL (in seconds) are mutually exclusive ways to limit the link lifetime.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	TTL       int64      `json:"ttl,omitempty"`
+	// Author is recorded in the revision history, it is taken from the X-Author header.
+	Author string `json:"-"`
 }
 
 type Item struct {
 	Key       string     `json:"key"`
+	KeyType   KeyType    `json:"keyType,omitempty" bson:"keyType,omitempty"`
 	Redirects []Redirect `json:"redirects"`
 	Visits    int        `json:"visits"`
+	Timezone  string     `json:"timezone,omitempty" bson:"timezone,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	// Version is incremented on every update, for optimistic concurrency.
+	Version   int        `json:"version"`
+	CreatedAt *time.Time `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	// State is set by the storage backends, deleted items are kept until purged.
+	State     State      `json:"state"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+}
+
+func (i *Item) Expired(t time.Time) bool {
+	return i.ExpiresAt != nil && !t.Before(*i.ExpiresAt)
+}
+
+// StandardID returns the ID of a standard item stored under key.
+func StandardID(key string, item *Item) (uint64, bool) {
+	if item.KeyType != KeyTypeStandard {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(key, 10, 64)
+	return id, err == nil
+}
+
+// LegacyKeyType works out the key type from the key of an item stored before
+// key types were recorded, when there were standard and uuid links only.
+func LegacyKeyType(key string) (KeyType, error) {
+	if _, err := strconv.ParseUint(key, 10, 64); err == nil {
+		return KeyTypeStandard, nil
+	}
+	if _, err := uuid.ParseHex(key); err == nil {
+		return KeyTypeUuid, nil
+	}
+	return "", fmt.Errorf("key type of %s is unknown", key)
+}
+
+// Revision is an immutable snapshot of the redirects of an item at a version.
+type Revision struct {
+	Key       string     `json:"key"`
+	Version   int        `json:"version"`
+	Redirects []Redirect `json:"redirects"`
+	Author    string     `json:"author,omitempty"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+}
+
+// RevisionDiff lists the redirects added and removed between two revisions.
+type RevisionDiff struct {
+	From    int        `json:"from"`
+	To      int        `json:"to"`
+	Added   []Redirect `json:"added"`
+	Removed []Redirect `json:"removed"`
 }
@@ -0,0 +1,144 @@
+package shortlink
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+type SortField string
+
+const (
+	SortByKey       SortField = "key"
+	SortByCreatedAt SortField = "createdAt"
+	SortByVisits    SortField = "visits"
+)
+
+// Query filters and orders items for the admin listing. Zero fields don't
+// filter, the items are sorted by key by default.
+type Query struct {
+	// Domain matches the items with a redirect to the host, see Domains.
+	Domain string
+	// CreatedFrom and CreatedTo limit the creation time, From inclusive
+	// and To exclusive. Items created before it was recorded don't match.
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	MinVisits   *int
+	MaxVisits   *int
+	KeyType     KeyType
+	State       *State
+	SortBy      SortField
+	Desc        bool
+	Offset      int
+	Limit       int
+}
+
+// QueryResult is a page of the items matching a query and their total number.
+type QueryResult struct {
+	Items []*Item `json:"items"`
+	Total int     `json:"total"`
+}
+
+// Match reports whether the item passes the filters of the query.
+func (q *Query) Match(item *Item) bool {
+	if q.Domain != "" && !containsString(Domains(item.Redirects), strings.ToLower(q.Domain)) {
+		return false
+	}
+	if q.CreatedFrom != nil && (item.CreatedAt == nil || item.CreatedAt.Before(*q.CreatedFrom)) {
+		return false
+	}
+	if q.CreatedTo != nil && (item.CreatedAt == nil || !item.CreatedAt.Before(*q.CreatedTo)) {
+		return false
+	}
+	if q.MinVisits != nil && item.Visits < *q.MinVisits {
+		return false
+	}
+	if q.MaxVisits != nil && item.Visits > *q.MaxVisits {
+		return false
+	}
+	if q.KeyType != "" && item.KeyType != q.KeyType {
+		return false
+	}
+	return q.State == nil || item.State == *q.State
+}
+
+// Sort orders items as the query asks, ties are broken by key so pages
+// are stable. Items without a creation time sort as the oldest.
+func (q *Query) Sort(items []*Item) {
+	less := func(c int) bool {
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		switch q.SortBy {
+		case SortByCreatedAt:
+			if c := compareTime(a.CreatedAt, b.CreatedAt); c != 0 {
+				return less(c)
+			}
+		case SortByVisits:
+			if a.Visits != b.Visits {
+				return less(a.Visits - b.Visits)
+			}
+		default:
+			return less(strings.Compare(a.Key, b.Key))
+		}
+		return a.Key < b.Key
+	})
+}
+
+// Page cuts the page given by the offset and limit of the query from sorted items.
+func (q *Query) Page(items []*Item) []*Item {
+	if q.Offset >= len(items) {
+		return []*Item{}
+	}
+	items = items[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(items) {
+		items = items[:q.Limit]
+	}
+	return items
+}
+
+// Domains returns the lowercased hosts the redirects point to, without duplicates.
+func Domains(redirects []Redirect) []string {
+	var domains []string
+	for _, r := range redirects {
+		u, err := url.Parse(r.URL)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		if !containsString(domains, host) {
+			domains = append(domains, host)
+		}
+	}
+	return domains
+}
+
+func compareTime(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	case a.Before(*b):
+		return -1
+	case b.Before(*a):
+		return 1
+	}
+	return 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
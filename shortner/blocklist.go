@@ -0,0 +1,151 @@
+package shortner
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"shortlink-service/shortlink"
+	"strings"
+	"unicode"
+)
+
+// reservedKeys are the first path segments of the server's own routes, a
+// key equal to one of them would be shadowed by the route.
+var reservedKeys = []string{"s", "u", "cron"}
+
+// Blocklist holds the keys that must not be handed out. Words block every
+// generated key containing them and every alias with them as one of its
+// words, reserved keys only block the exact key. Matching is case
+// insensitive.
+type Blocklist struct {
+	reserved map[string]bool
+	words    []string
+}
+
+// NewBlocklist creates a blocklist of the given words and reserved keys, the
+// server routes are always reserved.
+func NewBlocklist(words, reserved []string) *Blocklist {
+	b := &Blocklist{reserved: make(map[string]bool)}
+	for _, key := range append(reserved, reservedKeys...) {
+		b.reserved[strings.ToLower(key)] = true
+	}
+	for _, word := range words {
+		if word != "" {
+			b.words = append(b.words, strings.ToLower(word))
+		}
+	}
+	return b
+}
+
+// LoadBlocklist reads a blocklist file with one entry per line. Lines
+// starting with '=' reserve the exact key, the other lines are blocked
+// words. Empty lines and lines starting with '#' are skipped.
+func LoadBlocklist(path string) (*Blocklist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words, reserved []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "="):
+			reserved = append(reserved, strings.TrimPrefix(line, "="))
+		default:
+			words = append(words, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewBlocklist(words, reserved), nil
+}
+
+// Blocked reports whether the generated key is reserved or contains a
+// blocked word, so that no word shows up in a key by accident.
+func (b *Blocklist) Blocked(key string) bool {
+	key = strings.ToLower(key)
+	if b.reserved[key] {
+		return true
+	}
+	for _, word := range b.words {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockedAlias reports whether the alias is reserved or one of its words is
+// blocked. Aliases are chosen, so a word only blocks them as a whole word:
+// "kick-ass" is blocked by "ass", but "classic" is not.
+func (b *Blocklist) BlockedAlias(alias string) bool {
+	if b.reserved[strings.ToLower(alias)] {
+		return true
+	}
+	for _, aliasWord := range aliasWords(alias) {
+		for _, word := range b.words {
+			if aliasWord == word {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// aliasWords splits an alias into its lower case words at '-', '_', case
+// changes and between letters and digits, e.g. "bigSale-2021" into big, sale
+// and 2021.
+func aliasWords(alias string) []string {
+	var words []string
+	parts := strings.FieldsFunc(alias, func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+	for _, part := range parts {
+		runes := []rune(part)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			prev, cur := runes[i-1], runes[i]
+			// the last capital of a run starts the next word, e.g. "URLShortener"
+			upperRunEnd := unicode.IsUpper(prev) && unicode.IsUpper(cur) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) && unicode.IsUpper(cur) || unicode.IsDigit(prev) != unicode.IsDigit(cur) || upperRunEnd {
+				words = append(words, strings.ToLower(string(runes[start:i])))
+				start = i
+			}
+		}
+		words = append(words, strings.ToLower(string(runes[start:])))
+	}
+	return words
+}
+
+// BlockedShortLinks returns the existing shortlinks whose key is blocked,
+// with the public key set as their key, to review the links hit by an
+// updated blocklist.
+func (c *Client) BlockedShortLinks(ctx context.Context) ([]*shortlink.Item, error) {
+	items := make([]*shortlink.Item, 0)
+	err := c.EachShortLink(ctx, func(item *shortlink.Item) error {
+		key, err := c.publicKey(item)
+		if err != nil {
+			return err
+		}
+		blocked := c.blocklist.Blocked
+		if item.KeyType == shortlink.KeyTypeCustom {
+			blocked = c.blocklist.BlockedAlias
+		}
+		if !blocked(key) {
+			return nil
+		}
+		res := *item
+		res.Key = key
+		items = append(items, &res)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -5,113 +5,451 @@ import (
 	"errors"
 	"fmt"
 	uuid "github.com/nu7hatch/gouuid"
+	"regexp"
 	"shortlink-service/encoder"
 	"shortlink-service/shortlink"
 	"strconv"
 	"time"
 )
 
+const (
+	maxKeyAttempts = 10
+	// listPageSize is the number of items read from storage at once when
+	// iterating over all shortlinks.
+	listPageSize = 1000
+)
+
+var aliasRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
 type DbClient interface {
 	Get(ctx context.Context, key string) (*shortlink.Item, error)
+	// Set stores data under a new key, it fails with ErrKeyExists if the key
+	// is taken. Random keys rely on the check being atomic.
 	Set(ctx context.Context, key string, data *shortlink.Item) error
 	CreateGetID(ctx context.Context, data *shortlink.Item) (uint64, error)
+	// Delete soft deletes an item, Get returns ErrDeleted for it until it is restored or purged.
 	Delete(ctx context.Context, key string) error
+	// ListDeleted pages through the deleted items like List.
+	ListDeleted(ctx context.Context, after string, limit int) ([]*shortlink.Item, error)
+	Restore(ctx context.Context, key string) error
+	// Purge removes the items deleted before the given time and returns their number.
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)
+	// Remove removes the item stored under key for good, with its
+	// revisions. Unlike a deleted item it can not be restored.
+	Remove(ctx context.Context, key string) error
 	IncVisits(ctx context.Context, key string) error
+	// AddVisits adds the counts to the visits of the items stored under the
+	// keys, keys of missing or deleted items are skipped. If only some counts
+	// could not be added it returns a *shortlink.VisitsError with their keys,
+	// any other error means that no count was added.
+	AddVisits(ctx context.Context, visits map[string]int) error
 	GetVisits(ctx context.Context, key string) (int, error)
-	AsArray(ctx context.Context) ([]*shortlink.Item, error)
+	// List returns up to limit active items with a key greater than after,
+	// ordered by key. The key of the last item is the cursor of the next
+	// page, an empty after starts from the first item.
+	List(ctx context.Context, after string, limit int) ([]*shortlink.Item, error)
+	// Query returns the page of items, deleted ones included, matching the
+	// query and their total number.
+	Query(ctx context.Context, q *shortlink.Query) (*shortlink.QueryResult, error)
+	// Import stores the item under key as is, state and visits included,
+	// replacing a stored one and dropping its revisions. For a standard item
+	// the IDs handed out by CreateGetID continue after its key.
+	Import(ctx context.Context, key string, data *shortlink.Item) error
+	// Update replaces the redirects, timezone and expiry of the item stored
+	// under key if its version is still the given one, and bumps the version.
+	Update(ctx context.Context, key string, data *shortlink.Item, version int) error
+	AddRevision(ctx context.Context, rev *shortlink.Revision) error
+	// ListRevisions returns the revisions of the item stored under key, oldest first.
+	ListRevisions(ctx context.Context, key string) ([]*shortlink.Revision, error)
+}
+
+type Config struct {
+	BaseURL string
+	// KeySecret scrambles the IDs of standard keys, so the keys reveal
+	// neither the order nor the number of links. Changing it breaks the
+	// existing standard keys, when empty the keys are sequential.
+	KeySecret string
+	// Codec encodes the IDs of standard keys, plain base62 if nil.
+	Codec *encoder.Codec
+	// RandomKeyLength is the initial length of random keys, 6 if zero.
+	RandomKeyLength int
+	// Blocklist holds the keys that are not handed out, only the server
+	// routes are blocked if nil.
+	Blocklist *Blocklist
+	// StrictVisits counts every visit in storage before the redirect. By
+	// default the visits are buffered and written in batches, every
+	// VisitFlushInterval (1s if zero) or once VisitFlushSize (1000 if zero)
+	// keys have buffered visits. Close writes the remaining ones.
+	StrictVisits       bool
+	VisitFlushInterval time.Duration
+	VisitFlushSize     int
 }
 
 type Client struct {
-	baseUrl  string
-	dbClient DbClient
+	baseUrl   string
+	dbClient  DbClient
+	codec     *encoder.Codec
+	scrambler *encoder.Scrambler
+	// randomKeyLength is the current length of random keys, accessed atomically
+	randomKeyLength int32
+	blocklist       *Blocklist
+	// visits is nil in strict mode
+	visits *visitBuffer
 }
 
-func New(ctx context.Context, shortlinkBaseURL string, dbClient DbClient) (*Client, error) {
+func New(ctx context.Context, config Config, dbClient DbClient) (*Client, error) {
+	codec := config.Codec
+	if codec == nil {
+		var err error
+		codec, err = encoder.NewCodec(encoder.Config{MinLength: 1})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	randomKeyLength := config.RandomKeyLength
+	if randomKeyLength == 0 {
+		randomKeyLength = defaultRandomKeyLength
+	}
+	if randomKeyLength < 0 {
+		return nil, errors.New("random key length must be positive")
+	}
+
+	blocklist := config.Blocklist
+	if blocklist == nil {
+		blocklist = NewBlocklist(nil, nil)
+	}
+
+	flushInterval := config.VisitFlushInterval
+	if flushInterval == 0 {
+		flushInterval = defaultVisitFlushInterval
+	}
+	flushSize := config.VisitFlushSize
+	if flushSize == 0 {
+		flushSize = defaultVisitFlushSize
+	}
+	if flushInterval < 0 || flushSize < 0 {
+		return nil, errors.New("visit flush interval and size must be positive")
+	}
+
 	c := Client{
-		baseUrl:  shortlinkBaseURL,
-		dbClient: dbClient,
+		baseUrl:         config.BaseURL,
+		dbClient:        dbClient,
+		codec:           codec,
+		scrambler:       encoder.NewScrambler(config.KeySecret),
+		randomKeyLength: int32(randomKeyLength),
+		blocklist:       blocklist,
+	}
+	if !config.StrictVisits {
+		c.visits = newVisitBuffer(flushSize)
+		c.startVisitFlusher(ctx, flushInterval)
 	}
 	return &c, nil
 }
 
 func (c *Client) GenerateShortLink(ctx context.Context, data *shortlink.Input) (string, error) {
+	now := time.Now()
+	err := ValidateInput(data, now)
+	if err != nil {
+		return "", err
+	}
+	if data.Alias != "" && c.blocklist.BlockedAlias(data.Alias) {
+		return "", &ValidationError{Errors: []FieldError{{Field: "alias", Message: "is not allowed"}}}
+	}
+
+	createdAt := now.UTC()
 	item := &shortlink.Item{
+		KeyType:   data.KeyType,
 		Redirects: data.Redirects,
 		Visits:    0,
+		Timezone:  data.Timezone,
+		ExpiresAt: expiryFromInput(data, now),
+		Version:   1,
+		CreatedAt: &createdAt,
 	}
 
-	if data.KeyType == shortlink.KeyTypeUuid {
+	var key, shortLink string
+	switch {
+	case data.Alias != "":
+		item.KeyType = shortlink.KeyTypeCustom
+		err := c.setAlias(ctx, data.Alias, item)
+		if err != nil {
+			return "", err
+		}
+		key = data.Alias
+		shortLink = fmt.Sprintf("%s/%s", c.baseUrl, data.Alias)
+	case data.KeyType == shortlink.KeyTypeUuid:
 		u, err := uuid.NewV4()
 		if err != nil {
 			return "", err
 		}
-		key := u.String()
+		key = u.String()
 		err = c.dbClient.Set(ctx, key, item)
 		if err != nil {
 			return "", err
 		}
-
-		return fmt.Sprintf("%s/u/%s", c.baseUrl, key), nil
+		shortLink = fmt.Sprintf("%s/%s", c.baseUrl, key)
+	case data.KeyType == shortlink.KeyTypeRandom:
+		key, err = c.createRandomKey(ctx, item)
+		if err != nil {
+			return "", err
+		}
+		shortLink = fmt.Sprintf("%s/%s", c.baseUrl, key)
+	default:
+		item.KeyType = shortlink.KeyTypeStandard
+		id, err := c.createStandardID(ctx, item)
+		if err != nil {
+			return "", err
+		}
+		key = strconv.FormatUint(id, 10)
+		shortLink = fmt.Sprintf("%s/%s", c.baseUrl, c.encodeID(id))
 	}
 
-	id, err := c.dbClient.CreateGetID(ctx, item)
+	err = c.addRevision(ctx, key, item.Version, item.Redirects, data.Author)
 	if err != nil {
 		return "", err
 	}
-	key := encoder.Encode(id)
 
-	return fmt.Sprintf("%s/%s", c.baseUrl, key), nil
+	return shortLink, nil
 }
 
-func (c *Client) GetLongURL(ctx context.Context, originKey string, t time.Time, kt shortlink.KeyType, incVisits bool) (string, error) {
-	var key = originKey
+func (c *Client) GetLongURL(ctx context.Context, originKey string, t time.Time, incVisits bool) (string, error) {
+	key, data, err := c.resolve(ctx, originKey)
+	if err != nil {
+		return "", err
+	}
+	if data.Expired(t) {
+		return "", fmt.Errorf("%w: %s", ErrExpired, originKey)
+	}
 
-	if kt == shortlink.KeyTypeStandard {
-		decoded, err := encoder.Decode(key)
+	if incVisits && c.visits != nil {
+		c.visits.add(key, 1)
+	} else if incVisits {
+		err := c.dbClient.IncVisits(ctx, key)
 		if err != nil {
 			return "", err
 		}
-		key = strconv.FormatUint(decoded, 10)
 	}
 
-	if incVisits {
-		err := c.dbClient.IncVisits(ctx, key)
+	if data.Timezone != "" {
+		loc, err := time.LoadLocation(data.Timezone)
 		if err != nil {
 			return "", err
 		}
+		t = t.In(loc)
 	}
 
-	data, err := c.dbClient.Get(ctx, key)
+	return getUrlByTime(data, t)
+}
+
+// GetShortLink returns the item of a public key, with the public key set as its key.
+func (c *Client) GetShortLink(ctx context.Context, originKey string) (*shortlink.Item, error) {
+	key, data, err := c.resolve(ctx, originKey)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if data == nil {
-		return "", fmt.Errorf("shortlink data is not exist for key %s", key)
+	item := *data
+	item.Key = originKey
+	if c.visits != nil {
+		item.Visits += c.visits.pending(key)
 	}
+	return &item, nil
+}
 
-	return getUrlByTime(data, t)
+// UpdateShortLink replaces the redirects, timezone and expiry of a shortlink,
+// provided it is still at the given version. Key type and alias can't be changed.
+func (c *Client) UpdateShortLink(ctx context.Context, originKey string, data *shortlink.Input, version int) (*shortlink.Item, error) {
+	in := *data
+	in.KeyType = ""
+	in.Alias = ""
+	now := time.Now()
+	err := ValidateInput(&in, now)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, err := c.resolve(ctx, originKey)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedAt := now.UTC()
+	item := &shortlink.Item{
+		Redirects: in.Redirects,
+		Timezone:  in.Timezone,
+		ExpiresAt: expiryFromInput(&in, now),
+		UpdatedAt: &updatedAt,
+	}
+	err = c.dbClient.Update(ctx, key, item, version)
+	if err != nil {
+		return nil, err
+	}
+	err = c.addRevision(ctx, key, version+1, item.Redirects, in.Author)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GetShortLink(ctx, originKey)
 }
 
+// EachShortLink calls fn for every active shortlink, reading them from
+// storage one page at a time. It stops at the first error of fn.
+func (c *Client) EachShortLink(ctx context.Context, fn func(item *shortlink.Item) error) error {
+	return eachPage(ctx, c.dbClient.List, fn)
+}
 
-func (c *Client) GelAllShortLinks(ctx context.Context) ([]*shortlink.Item, error) {
-	return c.dbClient.AsArray(ctx)
+// EachDeletedShortLink calls fn for every deleted shortlink like EachShortLink.
+func (c *Client) EachDeletedShortLink(ctx context.Context, fn func(item *shortlink.Item) error) error {
+	return eachPage(ctx, c.dbClient.ListDeleted, fn)
+}
+
+// eachPage calls fn for every item of the pages of list.
+func eachPage(ctx context.Context, list func(ctx context.Context, after string, limit int) ([]*shortlink.Item, error), fn func(item *shortlink.Item) error) error {
+	after := ""
+	for {
+		items, err := list(ctx, after, listPageSize)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			err = fn(item)
+			if err != nil {
+				return err
+			}
+		}
+		if len(items) < listPageSize {
+			return nil
+		}
+		after = items[len(items)-1].Key
+	}
 }
 
 func (c *Client) DeleteShortLink(ctx context.Context, key string) error {
 	return c.dbClient.Delete(ctx, key)
 }
 
-func getUrlByTime(item *shortlink.Item, t time.Time) (string, error) {
-	if len(item.Redirects) == 0 || len(item.Redirects) > 24 {
-		return "", errors.New("invalid number of redirects")
+// ListDeletedShortLinks returns the deleted shortlinks with the public key
+// set as their key.
+func (c *Client) ListDeletedShortLinks(ctx context.Context) ([]*shortlink.Item, error) {
+	var items []*shortlink.Item
+	err := c.EachDeletedShortLink(ctx, func(item *shortlink.Item) error {
+		key, err := c.publicKey(item)
+		if err != nil {
+			return err
+		}
+		pub := *item
+		pub.Key = key
+		items = append(items, &pub)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// RestoreShortLink restores a deleted shortlink by its public key, the
+// storage key is told from the key itself like in resolve.
+func (c *Client) RestoreShortLink(ctx context.Context, originKey string) error {
+	if _, err := uuid.ParseHex(originKey); err == nil {
+		return c.dbClient.Restore(ctx, originKey)
+	}
+
+	decoded, decodeErr := c.decodeKey(originKey)
+	if decodeErr == nil {
+		err := c.dbClient.Restore(ctx, strconv.FormatUint(decoded, 10))
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+
+	// the decimal storage keys of standard items must not be reachable directly
+	if isNumeric(originKey) {
+		if decodeErr != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidKey, decodeErr)
+		}
+		return fmt.Errorf("%w: %s", ErrNotFound, originKey)
+	}
+	return c.dbClient.Restore(ctx, originKey)
+}
+
+// PurgeDeletedShortLinks permanently removes the shortlinks deleted longer than retention ago.
+func (c *Client) PurgeDeletedShortLinks(ctx context.Context, retention time.Duration) (int, error) {
+	return c.dbClient.Purge(ctx, time.Now().Add(-retention))
+}
+
+func (c *Client) setAlias(ctx context.Context, alias string, item *shortlink.Item) error {
+	decoded, err := c.decodeKey(alias)
+	if err == nil {
+		_, err := c.dbClient.Get(ctx, strconv.FormatUint(decoded, 10))
+		if err == nil || errors.Is(err, ErrDeleted) {
+			return fmt.Errorf("%w: %s", ErrKeyExists, alias)
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
 	}
 
-	h := t.Hour()
-	for _, r := range item.Redirects {
-		if h >= r.From && h < r.To {
-			return r.URL, nil
+	return c.dbClient.Set(ctx, alias, item)
+}
+
+// createStandardID allocates the next ID and skips the ones whose encoded
+// key is blocked or already used as a custom alias or random key. Unlike
+// random keys the attempts are not bounded: every attempt takes a new ID and
+// only finitely many keys are taken, but a filled short keyspace collides
+// with many IDs in a row.
+func (c *Client) createStandardID(ctx context.Context, item *shortlink.Item) (uint64, error) {
+	for {
+		id, err := c.dbClient.CreateGetID(ctx, item)
+		if err != nil {
+			return 0, err
+		}
+
+		encoded := c.encodeID(id)
+		if !c.blocklist.Blocked(encoded) {
+			data, err := c.dbClient.Get(ctx, encoded)
+			if errors.Is(err, ErrNotFound) || (err == nil && !storedByKey(data.KeyType)) {
+				return id, nil
+			}
+			if err != nil && !errors.Is(err, ErrDeleted) {
+				return 0, err
+			}
+		}
+
+		// the placeholder of a skipped ID must not be restorable
+		err = c.dbClient.Remove(ctx, strconv.FormatUint(id, 10))
+		if err != nil {
+			return 0, err
 		}
 	}
+}
+
+// storedByKey reports whether items of the key type are stored under their
+// public key rather than their ID, while sharing the URL shape of standard keys.
+func storedByKey(kt shortlink.KeyType) bool {
+	return kt == shortlink.KeyTypeCustom || kt == shortlink.KeyTypeRandom
+}
+
+func (c *Client) encodeID(id uint64) string {
+	return c.codec.Encode(c.scrambler.Scramble(id))
+}
 
-	return item.Redirects[0].URL, nil
+func (c *Client) decodeKey(key string) (uint64, error) {
+	id, err := c.codec.Decode(key)
+	if err != nil {
+		return 0, err
+	}
+	return c.scrambler.Unscramble(id), nil
+}
+
+func expiryFromInput(data *shortlink.Input, now time.Time) *time.Time {
+	if data.TTL > 0 {
+		expiresAt := now.Add(time.Duration(data.TTL) * time.Second).UTC()
+		return &expiresAt
+	}
+	if data.ExpiresAt != nil {
+		expiresAt := data.ExpiresAt.UTC()
+		return &expiresAt
+	}
+	return nil
 }
@@ -1,10 +1,16 @@
 package shortner
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"os"
 	"path/filepath"
 	"shortlink-service/dbmemory"
+	"shortlink-service/encoder"
 	"shortlink-service/shortlink"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -12,12 +18,12 @@ import (
 func TestClient_GenerateShortLink(t *testing.T) {
 	ctx := context.Background()
 
-	dbClient, err := dbmemory.New(ctx)
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
 	if err != nil {
 		t.Fatalf("error creating db client: %v", err)
 	}
 
-	c, err := New(ctx, "http://localhost", dbClient)
+	c, err := New(ctx, Config{BaseURL: "http://localhost"}, dbClient)
 	if err != nil {
 		t.Fatalf("error creating client: %v", err)
 	}
@@ -52,7 +58,7 @@ func TestClient_GenerateShortLink(t *testing.T) {
 	slKey := filepath.Base(sl)
 	n := time.Now()
 	urlTime := time.Date(n.Year(), n.Month(), n.Day(), 14, 0, 0, 0, n.Location())
-	url, err := c.GetLongURL(ctx, slKey, urlTime, shortlink.KeyTypeStandard, false)
+	url, err := c.GetLongURL(ctx, slKey, urlTime, false)
 	if err != nil {
 		t.Fatalf("failed to get shortlink data by key: %v", err)
 	}
@@ -64,7 +70,7 @@ func TestClient_GenerateShortLink(t *testing.T) {
 	t.Log("Getting url from uuid key....")
 	uuidKey := filepath.Base(slUid)
 	urlTime = time.Date(n.Year(), n.Month(), n.Day(), 21, 0, 0, 0, n.Location())
-	url, err = c.GetLongURL(ctx, uuidKey, urlTime, shortlink.KeyTypeUuid, false)
+	url, err = c.GetLongURL(ctx, uuidKey, urlTime, false)
 	if err != nil {
 		t.Fatalf("failed to get shortlink data by key: %v", err)
 	}
@@ -73,3 +79,999 @@ func TestClient_GenerateShortLink(t *testing.T) {
 	}
 	t.Logf("found url %s", url)
 }
+
+func TestClient_GenerateShortLinkAlias(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+
+	c, err := New(ctx, Config{BaseURL: "http://localhost"}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType: shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{
+			{From: 0, To: 24, URL: "https://google.com"},
+		},
+	}
+	sl, err := c.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("error generating shortlink: %v", err)
+	}
+
+	t.Log("Generating alias shortlink....")
+	input.Alias = "spring-sale"
+	slAlias, err := c.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("error generating alias shortlink: %v", err)
+	}
+	if slAlias != "http://localhost/spring-sale" {
+		t.Fatalf("alias shortlink is not correct. got: %s", slAlias)
+	}
+
+	url, err := c.GetLongURL(ctx, "spring-sale", time.Now(), false)
+	if err != nil {
+		t.Fatalf("failed to get shortlink data by alias: %v", err)
+	}
+	if url != "https://google.com" {
+		t.Fatalf("url is not correct. expected: %s, got: %s", "https://google.com", url)
+	}
+
+	t.Log("Testing alias collisions....")
+	_, err = c.GenerateShortLink(ctx, &input)
+	if !errors.Is(err, ErrKeyExists) {
+		t.Errorf("expected key exists error for taken alias, got: %v", err)
+	}
+	input.Alias = filepath.Base(sl)
+	_, err = c.GenerateShortLink(ctx, &input)
+	if !errors.Is(err, ErrKeyExists) {
+		t.Errorf("expected key exists error for alias of standard key, got: %v", err)
+	}
+	input.Alias = "no/slash"
+	_, err = c.GenerateShortLink(ctx, &input)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected invalid input error, got: %v", err)
+	}
+
+	t.Log("Testing standard keys skip aliases....")
+	input.Alias = "c"
+	_, err = c.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("error generating alias shortlink: %v", err)
+	}
+	input.Alias = ""
+	sl, err = c.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("error generating shortlink: %v", err)
+	}
+	if filepath.Base(sl) == "c" {
+		t.Errorf("standard key collided with alias %s", "c")
+	}
+}
+
+func TestClient_GetLongURLExpired(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+
+	c, err := New(ctx, Config{BaseURL: "http://localhost"}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType: shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{
+			{From: 0, To: 24, URL: "https://google.com"},
+		},
+		TTL: 60,
+	}
+	sl, err := c.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("error generating shortlink: %v", err)
+	}
+	slKey := filepath.Base(sl)
+
+	_, err = c.GetLongURL(ctx, slKey, time.Now(), false)
+	if err != nil {
+		t.Fatalf("failed to get shortlink before expiry: %v", err)
+	}
+	_, err = c.GetLongURL(ctx, slKey, time.Now().Add(time.Minute), false)
+	if !errors.Is(err, ErrExpired) {
+		t.Errorf("expected expired error, got: %v", err)
+	}
+
+	t.Log("Testing invalid expiry....")
+	past := time.Now().Add(-time.Hour)
+	input.ExpiresAt = &past
+	_, err = c.GenerateShortLink(ctx, &input)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected invalid input error for both ttl and expiresAt, got: %v", err)
+	}
+	input.TTL = 0
+	_, err = c.GenerateShortLink(ctx, &input)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected invalid input error for past expiresAt, got: %v", err)
+	}
+}
+
+func TestClient_GetLongURLTimezone(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+
+	c, err := New(ctx, Config{BaseURL: "http://localhost"}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType: shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{
+			{From: 0, To: 12, URL: "https://google.com"},
+			{From: 12, To: 24, URL: "https://youtube.com"},
+		},
+		Timezone: "America/New_York",
+	}
+	sl, err := c.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("error generating shortlink: %v", err)
+	}
+
+	// 15:00 UTC is still morning in New York
+	urlTime := time.Date(2021, time.October, 10, 15, 0, 0, 0, time.UTC)
+	url, err := c.GetLongURL(ctx, filepath.Base(sl), urlTime, false)
+	if err != nil {
+		t.Fatalf("failed to get shortlink data by key: %v", err)
+	}
+	if url != "https://google.com" {
+		t.Fatalf("url is not correct. expected: %s, got: %s", "https://google.com", url)
+	}
+
+	input.Timezone = "Mars/Olympus_Mons"
+	_, err = c.GenerateShortLink(ctx, &input)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected invalid input error for unknown timezone, got: %v", err)
+	}
+}
+
+func TestClient_UpdateShortLink(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+
+	c, err := New(ctx, Config{BaseURL: "http://localhost"}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType: shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{
+			{From: 0, To: 24, URL: "https://google.com"},
+		},
+	}
+	sl, err := c.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("error generating shortlink: %v", err)
+	}
+	slKey := filepath.Base(sl)
+
+	item, err := c.GetShortLink(ctx, slKey)
+	if err != nil {
+		t.Fatalf("failed to get shortlink: %v", err)
+	}
+	if item.Key != slKey || item.Version != 1 {
+		t.Fatalf("unexpected shortlink key %s version %d", item.Key, item.Version)
+	}
+
+	t.Log("Updating shortlink....")
+	input.Redirects = []shortlink.Redirect{{From: 0, To: 24, URL: "https://youtube.com"}}
+	item, err = c.UpdateShortLink(ctx, slKey, &input, item.Version)
+	if err != nil {
+		t.Fatalf("failed to update shortlink: %v", err)
+	}
+	if item.Version != 2 {
+		t.Errorf("version mismatch. expected: %d, got: %d", 2, item.Version)
+	}
+	url, err := c.GetLongURL(ctx, slKey, time.Now(), false)
+	if err != nil {
+		t.Fatalf("failed to get shortlink data by key: %v", err)
+	}
+	if url != "https://youtube.com" {
+		t.Fatalf("url is not correct. expected: %s, got: %s", "https://youtube.com", url)
+	}
+
+	t.Log("Testing concurrent update....")
+	input.Redirects = []shortlink.Redirect{{From: 0, To: 24, URL: "https://github.com"}}
+	_, err = c.UpdateShortLink(ctx, slKey, &input, 1)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected version conflict error, got: %v", err)
+	}
+}
+
+func TestClient_Revisions(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+
+	c, err := New(ctx, Config{BaseURL: "http://localhost"}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType: shortlink.KeyTypeUuid,
+		Redirects: []shortlink.Redirect{
+			{From: 0, To: 12, URL: "https://google.com"},
+			{From: 12, To: 24, URL: "https://youtube.com"},
+		},
+		Author: "alice",
+	}
+	sl, err := c.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("error generating shortlink: %v", err)
+	}
+	slKey := filepath.Base(sl)
+
+	input.Redirects = []shortlink.Redirect{
+		{From: 0, To: 12, URL: "https://google.com"},
+		{From: 12, To: 24, URL: "https://github.com"},
+	}
+	input.Author = "bob"
+	_, err = c.UpdateShortLink(ctx, slKey, &input, 1)
+	if err != nil {
+		t.Fatalf("failed to update shortlink: %v", err)
+	}
+
+	revs, err := c.ListRevisions(ctx, slKey)
+	if err != nil {
+		t.Fatalf("failed to list revisions: %v", err)
+	}
+	if len(revs) != 2 || revs[0].Author != "alice" || revs[1].Author != "bob" || revs[1].Version != 2 {
+		t.Fatalf("unexpected revisions: %+v", revs)
+	}
+
+	t.Log("Diffing revisions....")
+	diff, err := c.DiffRevisions(ctx, slKey, 1, 2)
+	if err != nil {
+		t.Fatalf("failed to diff revisions: %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].URL != "https://github.com" {
+		t.Errorf("unexpected added redirects: %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].URL != "https://youtube.com" {
+		t.Errorf("unexpected removed redirects: %v", diff.Removed)
+	}
+
+	t.Log("Rolling back....")
+	_, err = c.RollbackShortLink(ctx, slKey, 1, 1, "carol")
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected version conflict error, got: %v", err)
+	}
+	item, err := c.RollbackShortLink(ctx, slKey, 1, 2, "carol")
+	if err != nil {
+		t.Fatalf("failed to rollback shortlink: %v", err)
+	}
+	if item.Version != 3 || item.Redirects[1].URL != "https://youtube.com" {
+		t.Errorf("unexpected shortlink after rollback: %+v", item)
+	}
+	revs, err = c.ListRevisions(ctx, slKey)
+	if err != nil {
+		t.Fatalf("failed to list revisions: %v", err)
+	}
+	if len(revs) != 3 || revs[2].Author != "carol" {
+		t.Errorf("unexpected revisions after rollback: %+v", revs)
+	}
+}
+
+func TestClient_DeleteLifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+
+	c, err := New(ctx, Config{BaseURL: "http://localhost", KeySecret: "secret"}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType:   shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	}
+	sl, err := c.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("error generating shortlink: %v", err)
+	}
+	slKey := filepath.Base(sl)
+
+	var items []*shortlink.Item
+	err = c.EachShortLink(ctx, func(item *shortlink.Item) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil || len(items) != 1 {
+		t.Fatalf("failed to get shortlinks: %v %v", items, err)
+	}
+	key := items[0].Key
+
+	t.Log("Deleting shortlink....")
+	err = c.DeleteShortLink(ctx, key)
+	if err != nil {
+		t.Fatalf("failed to delete shortlink: %v", err)
+	}
+	_, err = c.GetLongURL(ctx, slKey, time.Now(), true)
+	if !errors.Is(err, ErrDeleted) {
+		t.Errorf("expected deleted error, got: %v", err)
+	}
+	deleted, err := c.ListDeletedShortLinks(ctx)
+	if err != nil || len(deleted) != 1 || deleted[0].Key != slKey {
+		t.Fatalf("unexpected deleted shortlinks: %v %v", deleted, err)
+	}
+
+	t.Log("Restoring shortlink....")
+	err = c.RestoreShortLink(ctx, key)
+	if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected the storage key to be rejected, got: %v", err)
+	}
+	err = c.RestoreShortLink(ctx, slKey)
+	if err != nil {
+		t.Fatalf("failed to restore shortlink: %v", err)
+	}
+	_, err = c.GetLongURL(ctx, slKey, time.Now(), true)
+	if err != nil {
+		t.Errorf("failed to get restored shortlink: %v", err)
+	}
+
+	t.Log("Purging shortlink....")
+	err = c.DeleteShortLink(ctx, key)
+	if err != nil {
+		t.Fatalf("failed to delete shortlink: %v", err)
+	}
+	purged, err := c.PurgeDeletedShortLinks(ctx, time.Hour)
+	if err != nil || purged != 0 {
+		t.Errorf("purged shortlinks within retention: %d %v", purged, err)
+	}
+	purged, err = c.PurgeDeletedShortLinks(ctx, 0)
+	if err != nil || purged != 1 {
+		t.Errorf("purged shortlinks mismatch. expected: %d, got: %d %v", 1, purged, err)
+	}
+	_, err = c.GetLongURL(ctx, slKey, time.Now(), true)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+func TestClient_ScrambledKeys(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+
+	c, err := New(ctx, Config{BaseURL: "http://localhost", KeySecret: "secret"}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType:   shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	}
+	for i := 1; i <= 3; i++ {
+		sl, err := c.GenerateShortLink(ctx, &input)
+		if err != nil {
+			t.Fatalf("error generating shortlink: %v", err)
+		}
+		slKey := filepath.Base(sl)
+		if slKey == encoder.Encode(uint64(i)) || len(slKey) > 6 {
+			t.Errorf("key %s of id %d is not scrambled", slKey, i)
+		}
+
+		item, err := c.GetShortLink(ctx, slKey)
+		if err != nil {
+			t.Fatalf("failed to get shortlink by scrambled key: %v", err)
+		}
+		t.Logf("id %d got key %s, version %d", i, slKey, item.Version)
+	}
+}
+
+func TestClient_CodecCheckChar(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+
+	codec, err := encoder.NewCodec(encoder.Config{MinLength: 3, CheckChar: true})
+	if err != nil {
+		t.Fatalf("error creating codec: %v", err)
+	}
+	c, err := New(ctx, Config{BaseURL: "http://localhost", Codec: codec}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType:   shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	}
+	sl, err := c.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("error generating shortlink: %v", err)
+	}
+	slKey := filepath.Base(sl)
+	if len(slKey) != 4 {
+		t.Errorf("key %s does not have min length and check character", slKey)
+	}
+
+	_, err = c.GetLongURL(ctx, slKey, time.Now(), false)
+	if err != nil {
+		t.Fatalf("failed to get shortlink data by key: %v", err)
+	}
+	typo := "c" + slKey[1:]
+	_, err = c.GetLongURL(ctx, typo, time.Now(), false)
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected invalid key error for typo %s of %s, got: %v", typo, slKey, err)
+	}
+}
+
+func TestClient_RandomKeys(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+
+	c, err := New(ctx, Config{BaseURL: "http://localhost", RandomKeyLength: 1}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType:   shortlink.KeyTypeRandom,
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	}
+
+	t.Log("Filling the one character keyspace....")
+	keys := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		sl, err := c.GenerateShortLink(ctx, &input)
+		if err != nil {
+			t.Fatalf("error generating random shortlink: %v", err)
+		}
+		slKey := filepath.Base(sl)
+		if keys[slKey] {
+			t.Fatalf("random key %s was generated twice", slKey)
+		}
+		keys[slKey] = true
+
+		item, err := c.GetShortLink(ctx, slKey)
+		if err != nil {
+			t.Fatalf("failed to get shortlink by random key %s: %v", slKey, err)
+		}
+		if item.KeyType != shortlink.KeyTypeRandom {
+			t.Errorf("expected key type %s, got: %s", shortlink.KeyTypeRandom, item.KeyType)
+		}
+	}
+
+	t.Log("Testing key length grows....")
+	sl, err := c.GenerateShortLink(ctx, &input)
+	if err != nil {
+		t.Fatalf("error generating random shortlink: %v", err)
+	}
+	if len(filepath.Base(sl)) < 2 {
+		t.Errorf("random key %s did not grow after the keyspace filled", filepath.Base(sl))
+	}
+
+	t.Log("Testing standard keys skip random keys....")
+	input.KeyType = shortlink.KeyTypeStandard
+	for i := 0; i < 20; i++ {
+		sl, err := c.GenerateShortLink(ctx, &input)
+		if err != nil {
+			t.Fatalf("error generating shortlink: %v", err)
+		}
+		if keys[filepath.Base(sl)] {
+			t.Fatalf("standard key collided with random key %s", filepath.Base(sl))
+		}
+	}
+}
+
+func TestClient_Blocklist(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	err = os.WriteFile(path, []byte("# test list\nC\n=d\n"), 0644)
+	if err != nil {
+		t.Fatalf("error writing blocklist: %v", err)
+	}
+	blocklist, err := LoadBlocklist(path)
+	if err != nil {
+		t.Fatalf("error loading blocklist: %v", err)
+	}
+
+	c, err := New(ctx, Config{BaseURL: "http://localhost", Blocklist: blocklist}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	input := shortlink.Input{
+		KeyType:   shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	}
+
+	t.Log("Testing standard keys skip blocked keys....")
+	for i := 0; i < 3; i++ {
+		sl, err := c.GenerateShortLink(ctx, &input)
+		if err != nil {
+			t.Fatalf("error generating shortlink: %v", err)
+		}
+		if slKey := filepath.Base(sl); slKey == "c" || slKey == "d" {
+			t.Errorf("blocked key %s was handed out", slKey)
+		}
+	}
+	deleted, err := c.ListDeletedShortLinks(ctx)
+	if err != nil {
+		t.Fatalf("failed to list deleted shortlinks: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("skipped keys can be restored: %+v", deleted)
+	}
+
+	t.Log("Testing blocked aliases....")
+	for _, alias := range []string{"s", "cron", "d", "x-c-x", "xC"} {
+		input.Alias = alias
+		_, err = c.GenerateShortLink(ctx, &input)
+		if !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("expected invalid input error for blocked alias %s, got: %v", alias, err)
+		}
+	}
+	for _, alias := range []string{"dd", "xcx", "abba", "b-side"} {
+		input.Alias = alias
+		_, err = c.GenerateShortLink(ctx, &input)
+		if err != nil {
+			t.Errorf("alias %s has no blocked word, got: %v", alias, err)
+		}
+	}
+
+	t.Log("Reporting links hit by an updated blocklist....")
+	c, err = New(ctx, Config{BaseURL: "http://localhost", Blocklist: NewBlocklist([]string{"b"}, []string{"dd"})}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	blocked, err := c.BlockedShortLinks(ctx)
+	if err != nil {
+		t.Fatalf("failed to list blocked shortlinks: %v", err)
+	}
+	keys := make(map[string]bool)
+	for _, item := range blocked {
+		keys[item.Key] = true
+	}
+	if len(blocked) != 3 || !keys["b"] || !keys["dd"] || !keys["b-side"] {
+		t.Errorf("expected blocked keys b, dd and b-side, got: %v", keys)
+	}
+}
+
+func TestBlocklist_BlockedAlias(t *testing.T) {
+	b := NewBlocklist([]string{"ass", "cum", "tit"}, []string{"admin"})
+	tests := []struct {
+		alias   string
+		blocked bool
+	}{
+		{"classic", false},
+		{"documents", false},
+		{"title", false},
+		{"password", false},
+		{"Admin", true},
+		{"admin-panel", false},
+		{"ass", true},
+		{"kick-ass", true},
+		{"big_ASS", true},
+		{"bigAss", true},
+		{"TITStore", true},
+		{"tit4tat", true},
+	}
+	for _, tt := range tests {
+		if blocked := b.BlockedAlias(tt.alias); blocked != tt.blocked {
+			t.Errorf("%s: blocked mismatch. expected: %v, got: %v", tt.alias, tt.blocked, blocked)
+		}
+	}
+	if !b.Blocked("xtitlex") {
+		t.Error("generated keys must be blocked by words within them")
+	}
+}
+
+func TestClient_QueryShortLinks(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+	c, err := New(ctx, Config{BaseURL: "http://localhost", KeySecret: "secret"}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	sl, err := c.GenerateShortLink(ctx, &shortlink.Input{
+		KeyType:   shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+	})
+	if err != nil {
+		t.Fatalf("error generating shortlink: %v", err)
+	}
+	_, err = c.GenerateShortLink(ctx, &shortlink.Input{
+		Alias:     "alias",
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://youtube.com"}},
+	})
+	if err != nil {
+		t.Fatalf("error generating shortlink: %v", err)
+	}
+
+	t.Log("Testing query returns public keys....")
+	res, err := c.QueryShortLinks(ctx, &shortlink.Query{Domain: "google.com"})
+	if err != nil {
+		t.Fatalf("error querying shortlinks: %v", err)
+	}
+	if res.Total != 1 || len(res.Items) != 1 || res.Items[0].Key != filepath.Base(sl) {
+		t.Fatalf("query result mismatch: %+v", res)
+	}
+	if created := res.Items[0].CreatedAt; created == nil || time.Since(*created) > time.Minute {
+		t.Errorf("expected the creation time to be set, got: %v", created)
+	}
+
+	t.Log("Testing the default limit....")
+	var q shortlink.Query
+	res, err = c.QueryShortLinks(ctx, &q)
+	if err != nil || res.Total != 2 || q.Limit != 0 {
+		t.Errorf("unexpected query result: %+v (%v), query: %+v", res, err, q)
+	}
+
+	t.Log("Testing invalid queries....")
+	for _, q := range []shortlink.Query{
+		{Limit: maxQueryLimit + 1},
+		{Offset: -1},
+		{SortBy: "url"},
+		{KeyType: "short"},
+		{MinVisits: intPtr(2), MaxVisits: intPtr(1)},
+	} {
+		_, err := c.QueryShortLinks(ctx, &q)
+		if !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("expected invalid input error for %+v, got: %v", q, err)
+		}
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestClient_ExportImport(t *testing.T) {
+	ctx := context.Background()
+
+	newClient := func() *Client {
+		dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+		if err != nil {
+			t.Fatalf("error creating db client: %v", err)
+		}
+		c, err := New(ctx, Config{BaseURL: "http://localhost", KeySecret: "secret"}, dbClient)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+		return c
+	}
+	src := newClient()
+
+	var links []string
+	for _, in := range []shortlink.Input{
+		{KeyType: shortlink.KeyTypeStandard, Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}}},
+		{KeyType: shortlink.KeyTypeRandom, Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://youtube.com"}}},
+		{Alias: "alias", Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://example.org"}}},
+		{KeyType: shortlink.KeyTypeStandard, Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com/deleted"}}},
+	} {
+		sl, err := src.GenerateShortLink(ctx, &in)
+		if err != nil {
+			t.Fatalf("error generating shortlink: %v", err)
+		}
+		links = append(links, filepath.Base(sl))
+	}
+	if _, err := src.GetLongURL(ctx, links[0], time.Now(), true); err != nil {
+		t.Fatalf("error visiting shortlink: %v", err)
+	}
+	id, err := src.decodeKey(links[3])
+	if err != nil {
+		t.Fatalf("error decoding key: %v", err)
+	}
+	if err := src.DeleteShortLink(ctx, strconv.FormatUint(id, 10)); err != nil {
+		t.Fatalf("error deleting shortlink: %v", err)
+	}
+
+	t.Log("Testing export....")
+	var buf bytes.Buffer
+	n, err := src.ExportShortLinks(ctx, &buf)
+	if err != nil || n != 4 {
+		t.Fatalf("unexpected export: %d (%v)", n, err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 4 {
+		t.Errorf("expected 4 lines, got: %d", lines)
+	}
+
+	t.Log("Testing import into another storage....")
+	dst := newClient()
+	n, err = dst.ImportShortLinks(ctx, &buf)
+	if err != nil || n != 4 {
+		t.Fatalf("unexpected import: %d (%v)", n, err)
+	}
+	for i, key := range links[:3] {
+		item, err := dst.GetShortLink(ctx, key)
+		if err != nil {
+			t.Errorf("error getting imported shortlink %s: %v", key, err)
+			continue
+		}
+		if i == 0 && item.Visits != 1 {
+			t.Errorf("expected the visits to be imported, got: %+v", item)
+		}
+		revs, err := dst.ListRevisions(ctx, key)
+		if err != nil || len(revs) != 1 || revs[0].Author != importAuthor {
+			t.Errorf("unexpected revisions of %s: %v (%v)", key, revs, err)
+		}
+	}
+	if _, err := dst.GetShortLink(ctx, links[3]); !errors.Is(err, ErrDeleted) {
+		t.Errorf("expected deleted error, got: %v", err)
+	}
+	sl, err := dst.GenerateShortLink(ctx, &shortlink.Input{
+		KeyType:   shortlink.KeyTypeStandard,
+		Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com/new"}},
+	})
+	if err != nil {
+		t.Fatalf("error generating shortlink: %v", err)
+	}
+	for _, key := range links {
+		if filepath.Base(sl) == key {
+			t.Errorf("imported key %s was handed out again", key)
+		}
+	}
+
+	t.Log("Testing imports of links exported before key types and versions....")
+	legacy := `{"key":"42","redirects":[{"from":0,"to":24,"url":"https://google.com"}],"visits":3,"state":1}
+{"key":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","redirects":[{"from":0,"to":24,"url":"https://google.com"}],"visits":0,"state":1}
+`
+	for i := 0; i < 2; i++ {
+		n, err = dst.ImportShortLinks(ctx, strings.NewReader(legacy))
+		if err != nil || n != 2 {
+			t.Fatalf("unexpected legacy import: %d (%v)", n, err)
+		}
+	}
+	for key, kt := range map[string]shortlink.KeyType{
+		"42":                                   shortlink.KeyTypeStandard,
+		"6ba7b810-9dad-11d1-80b4-00c04fd430c8": shortlink.KeyTypeUuid,
+	} {
+		item, err := dst.dbClient.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("error getting imported legacy item %s: %v", key, err)
+		}
+		if item.KeyType != kt || item.Version != 1 {
+			t.Errorf("imported legacy item %s mismatch: %+v", key, item)
+		}
+		revs, err := dst.dbClient.ListRevisions(ctx, key)
+		if err != nil || len(revs) != 1 {
+			t.Errorf("unexpected revisions of re-imported %s: %v (%v)", key, revs, err)
+		}
+	}
+	n, err = dst.ImportShortLinks(ctx, strings.NewReader(`{"key":"alias","redirects":[],"state":1}`))
+	if !errors.Is(err, ErrInvalidInput) || n != 0 {
+		t.Errorf("expected invalid input error for a legacy key of unknown type, got: %d (%v)", n, err)
+	}
+
+	t.Log("Testing invalid imports....")
+	in := `{"key":"a","keyType":"custom","redirects":[{"from":0,"to":24,"url":"https://google.com"}],"version":1,"state":1}
+{"key":"b","keyType":"custom","redirects":[{"from":0,"to":24,"url":"https://google.com"}],"version":1,"state":1}
+{"key":"x","keyType":"standard","redirects":[{"from":0,"to":24,"url":"https://google.com"}],"version":1,"state":1}
+`
+	n, err = dst.ImportShortLinks(ctx, strings.NewReader(in))
+	if !errors.Is(err, ErrInvalidInput) || n != 2 {
+		t.Errorf("expected invalid input error after 2 items, got: %d (%v)", n, err)
+	}
+	for name, line := range map[string]string{
+		"numeric custom key":   `{"key":"123","keyType":"custom","redirects":[{"from":0,"to":24,"url":"https://google.com"}],"version":1,"state":1}`,
+		"reserved custom key":  `{"key":"cron","keyType":"custom","redirects":[{"from":0,"to":24,"url":"https://google.com"}],"version":1,"state":1}`,
+		"malformed random key": `{"key":"a/b","keyType":"random","redirects":[{"from":0,"to":24,"url":"https://google.com"}],"version":1,"state":1}`,
+		"no redirects":         `{"key":"c","keyType":"custom","redirects":[],"version":1,"state":1}`,
+		"bad redirect url":     `{"key":"c","keyType":"custom","redirects":[{"from":0,"to":24,"url":"google"}],"version":1,"state":1}`,
+		"bad redirect window":  `{"key":"c","keyType":"custom","redirects":[{"from":0,"to":12,"url":"https://google.com"}],"version":1,"state":1}`,
+	} {
+		n, err = dst.ImportShortLinks(ctx, strings.NewReader(line))
+		if !errors.Is(err, ErrInvalidInput) || n != 0 {
+			t.Errorf("expected invalid input error for a %s, got: %d (%v)", name, n, err)
+		}
+	}
+	if _, err := dst.dbClient.Get(ctx, "123"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the numeric custom key not to be stored, got: %v", err)
+	}
+	n, err = dst.ImportShortLinks(ctx, strings.NewReader(`{"key":`))
+	if !errors.Is(err, ErrInvalidInput) || n != 0 {
+		t.Errorf("expected invalid input error, got: %d (%v)", n, err)
+	}
+}
+
+// failingVisits fails the first AddVisits calls, and the counts of failKeys
+// in the next call.
+type failingVisits struct {
+	DbClient
+	failures int
+	failKeys map[string]bool
+}
+
+func (f *failingVisits) AddVisits(ctx context.Context, visits map[string]int) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("storage unavailable")
+	}
+	if f.failKeys == nil {
+		return f.DbClient.AddVisits(ctx, visits)
+	}
+	applied := make(map[string]int)
+	var failed []string
+	for key, n := range visits {
+		if f.failKeys[key] {
+			failed = append(failed, key)
+		} else {
+			applied[key] = n
+		}
+	}
+	f.failKeys = nil
+	err := f.DbClient.AddVisits(ctx, applied)
+	if err != nil {
+		return err
+	}
+	return &shortlink.VisitsError{Keys: failed, Err: errors.New("storage unavailable")}
+}
+
+func TestClient_BufferedVisits(t *testing.T) {
+	ctx := context.Background()
+
+	dbClient, err := dbmemory.New(ctx, dbmemory.Config{})
+	if err != nil {
+		t.Fatalf("error creating db client: %v", err)
+	}
+	storage := &failingVisits{DbClient: dbClient}
+	c, err := New(ctx, Config{BaseURL: "http://localhost", VisitFlushInterval: time.Hour, VisitFlushSize: 3}, storage)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	var keys []string
+	for i := 0; i < 3; i++ {
+		sl, err := c.GenerateShortLink(ctx, &shortlink.Input{
+			KeyType:   shortlink.KeyTypeStandard,
+			Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+		})
+		if err != nil {
+			t.Fatalf("error generating shortlink: %v", err)
+		}
+		keys = append(keys, filepath.Base(sl))
+	}
+	visits := func(i int) int {
+		t.Helper()
+		v, err := dbClient.GetVisits(ctx, strconv.Itoa(i+1))
+		if err != nil {
+			t.Fatalf("error getting visits: %v", err)
+		}
+		return v
+	}
+
+	t.Log("Testing visits are buffered....")
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetLongURL(ctx, keys[0], time.Now(), true); err != nil {
+			t.Fatalf("error getting long url: %v", err)
+		}
+	}
+	if v := visits(0); v != 0 {
+		t.Errorf("expected no stored visits before the flush, got: %d", v)
+	}
+	item, err := c.GetShortLink(ctx, keys[0])
+	if err != nil || item.Visits != 3 {
+		t.Errorf("expected the buffered visits in the shortlink, got: %+v (%v)", item, err)
+	}
+
+	t.Log("Testing failed flushes keep the visits....")
+	storage.failures = 1
+	if err := c.FlushVisits(ctx); err == nil {
+		t.Error("expected flush error")
+	}
+	if err := c.FlushVisits(ctx); err != nil {
+		t.Fatalf("error flushing visits: %v", err)
+	}
+	if v := visits(0); v != 3 {
+		t.Errorf("visits mismatch. expected: %d, got: %d", 3, v)
+	}
+
+	t.Log("Testing a full buffer is flushed....")
+	for _, key := range keys {
+		if _, err := c.GetLongURL(ctx, key, time.Now(), true); err != nil {
+			t.Fatalf("error getting long url: %v", err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for visits(2) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if v := visits(0); v != 4 {
+		t.Errorf("visits mismatch. expected: %d, got: %d", 4, v)
+	}
+	if v := visits(2); v != 1 {
+		t.Errorf("visits mismatch. expected: %d, got: %d", 1, v)
+	}
+
+	t.Log("Testing partly failed flushes only keep the failed visits....")
+	for _, key := range keys[:2] {
+		if _, err := c.GetLongURL(ctx, key, time.Now(), true); err != nil {
+			t.Fatalf("error getting long url: %v", err)
+		}
+	}
+	storage.failKeys = map[string]bool{strconv.Itoa(2): true}
+	var visitsErr *shortlink.VisitsError
+	if err := c.FlushVisits(ctx); !errors.As(err, &visitsErr) {
+		t.Errorf("expected visits error, got: %v", err)
+	}
+	if err := c.FlushVisits(ctx); err != nil {
+		t.Fatalf("error flushing visits: %v", err)
+	}
+	if v := visits(0); v != 5 {
+		t.Errorf("visits mismatch. expected: %d, got: %d", 5, v)
+	}
+	if v := visits(1); v != 2 {
+		t.Errorf("visits mismatch. expected: %d, got: %d", 2, v)
+	}
+
+	t.Log("Testing close drains the buffer....")
+	if _, err := c.GetLongURL(ctx, keys[1], time.Now(), true); err != nil {
+		t.Fatalf("error getting long url: %v", err)
+	}
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("error closing client: %v", err)
+	}
+	if v := visits(1); v != 3 {
+		t.Errorf("visits mismatch. expected: %d, got: %d", 3, v)
+	}
+
+	t.Log("Testing strict visits....")
+	strict, err := New(ctx, Config{BaseURL: "http://localhost", StrictVisits: true}, dbClient)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	if _, err := strict.GetLongURL(ctx, keys[2], time.Now(), true); err != nil {
+		t.Fatalf("error getting long url: %v", err)
+	}
+	if v := visits(2); v != 2 {
+		t.Errorf("visits mismatch. expected: %d, got: %d", 2, v)
+	}
+}
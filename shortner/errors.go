@@ -0,0 +1,18 @@
+package shortner
+
+import (
+	"errors"
+	"shortlink-service/shortlink"
+)
+
+// Storage errors are defined in shortlink so backends can return them
+// without importing shortner.
+var (
+	ErrNotFound        = shortlink.ErrNotFound
+	ErrDeleted         = shortlink.ErrDeleted
+	ErrKeyExists       = shortlink.ErrKeyExists
+	ErrVersionConflict = shortlink.ErrVersionConflict
+	ErrInvalidKey      = errors.New("invalid key")
+	ErrInvalidInput    = errors.New("invalid input")
+	ErrExpired         = errors.New("shortlink expired")
+)
@@ -0,0 +1,140 @@
+package shortner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"shortlink-service/shortlink"
+	"strconv"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// importAuthor is the author of the revision recorded for imported shortlinks.
+const importAuthor = "import"
+
+// ExportShortLinks writes every shortlink, deleted ones included, to w as
+// NDJSON and returns their number. The items keep their storage keys, so
+// the standard keys stay the same with the same key secret and codec.
+func (c *Client) ExportShortLinks(ctx context.Context, w io.Writer) (int, error) {
+	err := c.FlushVisits(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	enc := json.NewEncoder(w)
+	var n int
+	write := func(item *shortlink.Item) error {
+		err := enc.Encode(item)
+		if err != nil {
+			return err
+		}
+		n++
+		return nil
+	}
+	err = c.EachShortLink(ctx, write)
+	if err != nil {
+		return n, err
+	}
+	err = c.EachDeletedShortLink(ctx, write)
+	return n, err
+}
+
+// ImportShortLinks stores the NDJSON shortlinks of r, as written by
+// ExportShortLinks, under their keys and returns their number. Stored
+// shortlinks with the same keys are replaced. It stops at the first invalid
+// line, the lines before it are imported.
+func (c *Client) ImportShortLinks(ctx context.Context, r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	var n int
+	for {
+		var item shortlink.Item
+		err := dec.Decode(&item)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("%w: item %d: %v", ErrInvalidInput, n+1, err)
+		}
+		err = c.prepareImport(&item)
+		if err != nil {
+			return n, fmt.Errorf("%w: item %d: %v", ErrInvalidInput, n+1, err)
+		}
+
+		err = c.dbClient.Import(ctx, item.Key, &item)
+		if err != nil {
+			return n, err
+		}
+		// revisions are not exported, start the history at the imported version
+		err = c.addRevision(ctx, item.Key, item.Version, item.Redirects, importAuthor)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// prepareImport validates an imported item. Items stored before the key type
+// and version were recorded get them filled in. Custom and random keys follow
+// the rules of the created ones, and the redirects are validated like on
+// creation. The expiry is not, expired items are imported as expired.
+func (c *Client) prepareImport(item *shortlink.Item) error {
+	if item.Key == "" {
+		return errors.New("key is required")
+	}
+	if item.KeyType == "" {
+		kt, err := shortlink.LegacyKeyType(item.Key)
+		if err != nil {
+			return err
+		}
+		item.KeyType = kt
+	}
+	if item.Version == 0 {
+		item.Version = 1
+	}
+	switch item.KeyType {
+	case shortlink.KeyTypeStandard:
+		if _, err := strconv.ParseUint(item.Key, 10, 64); err != nil {
+			return fmt.Errorf("standard key %s is not an ID", item.Key)
+		}
+	case shortlink.KeyTypeUuid:
+		if _, err := uuid.ParseHex(item.Key); err != nil {
+			return fmt.Errorf("uuid key %s is not a uuid", item.Key)
+		}
+	case shortlink.KeyTypeCustom, shortlink.KeyTypeRandom:
+		if !aliasRegexp.MatchString(item.Key) {
+			return fmt.Errorf("%s key %s may only contain letters, digits, '-' and '_' (max 64)", item.KeyType, item.Key)
+		}
+		if isNumeric(item.Key) {
+			return fmt.Errorf("%s key %s must not be numeric", item.KeyType, item.Key)
+		}
+		blocked := c.blocklist.Blocked
+		if item.KeyType == shortlink.KeyTypeCustom {
+			blocked = c.blocklist.BlockedAlias
+		}
+		if blocked(item.Key) {
+			return fmt.Errorf("%s key %s is not allowed", item.KeyType, item.Key)
+		}
+	default:
+		return fmt.Errorf("unknown key type %s", item.KeyType)
+	}
+	if item.State != shortlink.StateActive && item.State != shortlink.StateDeleted {
+		return fmt.Errorf("unknown state %d", item.State)
+	}
+	if item.Version < 1 {
+		return errors.New("version must be positive")
+	}
+
+	verr := &ValidationError{}
+	if _, err := time.LoadLocation(item.Timezone); err != nil {
+		verr.add("timezone", "unknown timezone %s", item.Timezone)
+	}
+	validateRedirects(verr, item.Redirects)
+	if len(verr.Errors) > 0 {
+		return errors.New(verr.messages())
+	}
+	return nil
+}
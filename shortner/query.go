@@ -0,0 +1,82 @@
+package shortner
+
+import (
+	"context"
+	"shortlink-service/shortlink"
+	"strconv"
+)
+
+const (
+	defaultQueryLimit = 50
+	maxQueryLimit     = 1000
+)
+
+// QueryShortLinks returns a page of the shortlinks matching the query, with
+// the public key set as their key. The limit is 50 if zero and at most 1000.
+func (c *Client) QueryShortLinks(ctx context.Context, q *shortlink.Query) (*shortlink.QueryResult, error) {
+	query := *q
+	if query.Limit == 0 {
+		query.Limit = defaultQueryLimit
+	}
+	err := validateQuery(&query)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.dbClient.Query(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range res.Items {
+		key, err := c.publicKey(item)
+		if err != nil {
+			return nil, err
+		}
+		pub := *item
+		pub.Key = key
+		res.Items[i] = &pub
+	}
+	return res, nil
+}
+
+func validateQuery(q *shortlink.Query) error {
+	verr := &ValidationError{}
+	if q.Limit < 0 || q.Limit > maxQueryLimit {
+		verr.add("limit", "must be between 1 and %d", maxQueryLimit)
+	}
+	if q.Offset < 0 {
+		verr.add("offset", "must not be negative")
+	}
+	switch q.SortBy {
+	case "", shortlink.SortByKey, shortlink.SortByCreatedAt, shortlink.SortByVisits:
+	default:
+		verr.add("sort", "unknown sort field %s", q.SortBy)
+	}
+	switch q.KeyType {
+	case "", shortlink.KeyTypeStandard, shortlink.KeyTypeUuid, shortlink.KeyTypeCustom, shortlink.KeyTypeRandom:
+	default:
+		verr.add("keyType", "unknown key type %s", q.KeyType)
+	}
+	if q.State != nil && *q.State != shortlink.StateActive && *q.State != shortlink.StateDeleted {
+		verr.add("state", "unknown state %d", *q.State)
+	}
+	if q.MinVisits != nil && q.MaxVisits != nil && *q.MinVisits > *q.MaxVisits {
+		verr.add("maxVisits", "must not be less than minVisits")
+	}
+	if q.CreatedFrom != nil && q.CreatedTo != nil && q.CreatedTo.Before(*q.CreatedFrom) {
+		verr.add("createdTo", "must not be before createdFrom")
+	}
+	return verr.orNil()
+}
+
+// publicKey returns the key a stored item is served under.
+func (c *Client) publicKey(item *shortlink.Item) (string, error) {
+	if item.KeyType != shortlink.KeyTypeStandard {
+		return item.Key, nil
+	}
+	id, err := strconv.ParseUint(item.Key, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	return c.encodeID(id), nil
+}
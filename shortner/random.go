@@ -0,0 +1,72 @@
+package shortner
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"shortlink-service/encoder"
+	"shortlink-service/shortlink"
+	"sync/atomic"
+)
+
+const (
+	defaultRandomKeyLength = 6
+	// randomKeyCollisions is the number of collisions tolerated at a key
+	// length before it grows, a sign the keyspace is filling up.
+	randomKeyCollisions = 3
+)
+
+// createRandomKey stores the item under a new random base62 key. The key
+// length starts at the configured one and grows by one every
+// randomKeyCollisions collisions, for this and the following keys.
+func (c *Client) createRandomKey(ctx context.Context, item *shortlink.Item) (string, error) {
+	var collisions int
+	for i := 0; i < maxKeyAttempts; i++ {
+		length := atomic.LoadInt32(&c.randomKeyLength)
+		key, err := randomKey(int(length))
+		if err != nil {
+			return "", err
+		}
+		if isNumeric(key) || c.blocklist.Blocked(key) {
+			// numeric keys are the storage keys of standard items, blocked keys are never handed out
+			continue
+		}
+
+		err = c.setAlias(ctx, key, item)
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, ErrKeyExists) {
+			return "", err
+		}
+
+		collisions++
+		if collisions%randomKeyCollisions == 0 {
+			atomic.CompareAndSwapInt32(&c.randomKeyLength, length, length+1)
+		}
+	}
+	return "", errors.New("failed to allocate random key")
+}
+
+func randomKey(length int) (string, error) {
+	max := big.NewInt(int64(len(encoder.DefaultAlphabet)))
+	key := make([]byte, length)
+	for i := range key {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		key[i] = encoder.DefaultAlphabet[n.Int64()]
+	}
+	return string(key), nil
+}
+
+func isNumeric(key string) bool {
+	for i := 0; i < len(key); i++ {
+		if key[i] < '0' || key[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
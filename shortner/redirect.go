@@ -0,0 +1,109 @@
+package shortner
+
+import (
+	"errors"
+	"shortlink-service/shortlink"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// getUrlByTime returns the URL of the most specific redirect matching t.
+// A date range is more specific than a weekday set, which is more specific
+// than a plain daily window. Equally specific redirects are matched in order.
+func getUrlByTime(item *shortlink.Item, t time.Time) (string, error) {
+	if len(item.Redirects) == 0 {
+		return "", errors.New("shortlink has no redirects")
+	}
+
+	best, bestRank := -1, -1
+	for i, r := range item.Redirects {
+		ok, err := redirectMatches(r, t)
+		if err != nil {
+			return "", err
+		}
+		if rank := redirectRank(r); ok && rank > bestRank {
+			best, bestRank = i, rank
+		}
+	}
+	if best == -1 {
+		return item.Redirects[0].URL, nil
+	}
+
+	return item.Redirects[best].URL, nil
+}
+
+func redirectRank(r shortlink.Redirect) int {
+	var rank int
+	if r.StartDate != "" || r.EndDate != "" {
+		rank += 2
+	}
+	if len(r.Weekdays) > 0 {
+		rank++
+	}
+	return rank
+}
+
+func redirectMatches(r shortlink.Redirect, t time.Time) (bool, error) {
+	start, end := windowMinutes(r)
+	m := t.Hour()*60 + t.Minute()
+
+	day := t
+	switch {
+	case start < end:
+		if m < start || m >= end {
+			return false, nil
+		}
+	case start > end:
+		if m < start && m >= end {
+			return false, nil
+		}
+		if m < end {
+			day = t.AddDate(0, 0, -1)
+		}
+	default:
+		return false, nil
+	}
+
+	if len(r.Weekdays) > 0 && !containsWeekday(r.Weekdays, day.Weekday()) {
+		return false, nil
+	}
+
+	return inDateRange(r, day)
+}
+
+func windowMinutes(r shortlink.Redirect) (int, int) {
+	return r.From*60 + r.FromMinute, r.To*60 + r.ToMinute
+}
+
+func containsWeekday(days []time.Weekday, d time.Weekday) bool {
+	for _, wd := range days {
+		if wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+func inDateRange(r shortlink.Redirect, day time.Time) (bool, error) {
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	if r.StartDate != "" {
+		start, err := time.ParseInLocation(dateLayout, r.StartDate, day.Location())
+		if err != nil {
+			return false, err
+		}
+		if date.Before(start) {
+			return false, nil
+		}
+	}
+	if r.EndDate != "" {
+		end, err := time.ParseInLocation(dateLayout, r.EndDate, day.Location())
+		if err != nil {
+			return false, err
+		}
+		if date.After(end) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
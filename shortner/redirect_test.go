@@ -0,0 +1,46 @@
+package shortner
+
+import (
+	"shortlink-service/shortlink"
+	"testing"
+	"time"
+)
+
+func TestGetUrlByTime(t *testing.T) {
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	item := &shortlink.Item{
+		Redirects: []shortlink.Redirect{
+			{From: 6, To: 22, URL: "https://default.com"},
+			{From: 9, FromMinute: 30, To: 17, ToMinute: 45, Weekdays: weekdays, URL: "https://office.com"},
+			{From: 22, To: 6, URL: "https://night.com"},
+			{From: 0, To: 24, StartDate: "2021-11-26", EndDate: "2021-11-26", URL: "https://black-friday.com"},
+			{From: 23, To: 2, Weekdays: []time.Weekday{time.Friday}, URL: "https://friday-party.com"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want string
+	}{
+		{"weekday before window", time.Date(2021, 11, 22, 9, 29, 0, 0, time.UTC), "https://default.com"},
+		{"weekday window start", time.Date(2021, 11, 22, 9, 30, 0, 0, time.UTC), "https://office.com"},
+		{"weekday window end", time.Date(2021, 11, 22, 17, 45, 0, 0, time.UTC), "https://default.com"},
+		{"weekend", time.Date(2021, 11, 20, 12, 0, 0, 0, time.UTC), "https://default.com"},
+		{"wrap before midnight", time.Date(2021, 11, 22, 23, 0, 0, 0, time.UTC), "https://night.com"},
+		{"wrap after midnight", time.Date(2021, 11, 23, 5, 59, 0, 0, time.UTC), "https://night.com"},
+		{"date range wins", time.Date(2021, 11, 26, 12, 0, 0, 0, time.UTC), "https://black-friday.com"},
+		{"wrap keeps start weekday", time.Date(2021, 11, 27, 1, 0, 0, 0, time.UTC), "https://friday-party.com"},
+		{"wrap ends on next day", time.Date(2021, 11, 27, 2, 0, 0, 0, time.UTC), "https://night.com"},
+	}
+
+	for _, tt := range tests {
+		got, err := getUrlByTime(item, tt.t)
+		if err != nil {
+			t.Fatalf("%s: error getting url: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: url is not correct. expected: %s, got: %s", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package shortner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	uuid "github.com/nu7hatch/gouuid"
+	"shortlink-service/shortlink"
+	"strconv"
+)
+
+// resolve identifies the key type of a public key from the key itself and
+// returns its storage key and item, so every key type shares one URL shape.
+// UUID keys, custom aliases and random keys are stored under the key itself,
+// standard keys are encoded IDs stored under the decimal ID.
+func (c *Client) resolve(ctx context.Context, originKey string) (string, *shortlink.Item, error) {
+	if _, err := uuid.ParseHex(originKey); err == nil {
+		data, err := c.dbClient.Get(ctx, originKey)
+		if err != nil {
+			return "", nil, err
+		}
+		return originKey, data, nil
+	}
+
+	decoded, decodeErr := c.decodeKey(originKey)
+	if decodeErr == nil {
+		key := strconv.FormatUint(decoded, 10)
+		data, err := c.dbClient.Get(ctx, key)
+		if err == nil {
+			return key, data, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return "", nil, err
+		}
+	}
+
+	// the decimal storage keys of standard items must not be reachable directly
+	data, err := c.dbClient.Get(ctx, originKey)
+	if err == nil && !storedByKey(data.KeyType) {
+		err = fmt.Errorf("%w: %s", ErrNotFound, originKey)
+	}
+	if errors.Is(err, ErrNotFound) && decodeErr != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidKey, decodeErr)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return originKey, data, nil
+}
@@ -0,0 +1,113 @@
+package shortner
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"shortlink-service/shortlink"
+	"time"
+)
+
+// ListRevisions returns the revisions of a shortlink, oldest first, with the public key set as their key.
+func (c *Client) ListRevisions(ctx context.Context, originKey string) ([]*shortlink.Revision, error) {
+	key, _, err := c.resolve(ctx, originKey)
+	if err != nil {
+		return nil, err
+	}
+
+	revs, err := c.dbClient.ListRevisions(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*shortlink.Revision, len(revs))
+	for i, rev := range revs {
+		r := *rev
+		r.Key = originKey
+		res[i] = &r
+	}
+	return res, nil
+}
+
+// DiffRevisions returns the redirects added and removed from version from to version to.
+func (c *Client) DiffRevisions(ctx context.Context, originKey string, from, to int) (*shortlink.RevisionDiff, error) {
+	revs, err := c.ListRevisions(ctx, originKey)
+	if err != nil {
+		return nil, err
+	}
+	fromRev, err := findRevision(revs, from)
+	if err != nil {
+		return nil, err
+	}
+	toRev, err := findRevision(revs, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &shortlink.RevisionDiff{
+		From:    from,
+		To:      to,
+		Added:   redirectsMissing(toRev.Redirects, fromRev.Redirects),
+		Removed: redirectsMissing(fromRev.Redirects, toRev.Redirects),
+	}, nil
+}
+
+// RollbackShortLink restores the redirects of a previous revision, as a new
+// revision on top of version, which must still be the current one.
+func (c *Client) RollbackShortLink(ctx context.Context, originKey string, toVersion, version int, author string) (*shortlink.Item, error) {
+	revs, err := c.ListRevisions(ctx, originKey)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := findRevision(revs, toVersion)
+	if err != nil {
+		return nil, err
+	}
+	current, err := c.GetShortLink(ctx, originKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.UpdateShortLink(ctx, originKey, &shortlink.Input{
+		Redirects: rev.Redirects,
+		Timezone:  current.Timezone,
+		ExpiresAt: current.ExpiresAt,
+		Author:    author,
+	}, version)
+}
+
+func (c *Client) addRevision(ctx context.Context, key string, version int, redirects []shortlink.Redirect, author string) error {
+	return c.dbClient.AddRevision(ctx, &shortlink.Revision{
+		Key:       key,
+		Version:   version,
+		Redirects: redirects,
+		Author:    author,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+func findRevision(revs []*shortlink.Revision, version int) (*shortlink.Revision, error) {
+	for _, rev := range revs {
+		if rev.Version == version {
+			return rev, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: revision %d is not exist", ErrInvalidInput, version)
+}
+
+// redirectsMissing returns the redirects of a that are not in b.
+func redirectsMissing(a, b []shortlink.Redirect) []shortlink.Redirect {
+	missing := []shortlink.Redirect{}
+	for _, ra := range a {
+		var found bool
+		for _, rb := range b {
+			if reflect.DeepEqual(ra, rb) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, ra)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,212 @@
+package shortner
+
+import (
+	"fmt"
+	"net/url"
+	"shortlink-service/shortlink"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxRedirects = 24
+	dayMinutes   = 24 * 60
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of an input. It matches
+// ErrInvalidInput with errors.Is.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrInvalidInput, e.messages())
+}
+
+func (e *ValidationError) messages() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fmt.Sprintf("%s: %s", fe.Field, fe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *ValidationError) orNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// ValidateInput checks a shortlink input as GenerateShortLink would, without creating it.
+func ValidateInput(in *shortlink.Input, now time.Time) error {
+	verr := &ValidationError{}
+
+	switch in.KeyType {
+	case "", shortlink.KeyTypeStandard, shortlink.KeyTypeUuid, shortlink.KeyTypeRandom:
+	default:
+		verr.add("keyType", "unknown key type %s", in.KeyType)
+	}
+
+	if in.Alias != "" {
+		if !aliasRegexp.MatchString(in.Alias) {
+			verr.add("alias", "may only contain letters, digits, '-' and '_' (max 64)")
+		} else if _, err := strconv.ParseUint(in.Alias, 10, 64); err == nil {
+			verr.add("alias", "must not be numeric")
+		}
+	}
+
+	if in.ExpiresAt != nil && in.TTL != 0 {
+		verr.add("ttl", "expiresAt and ttl are mutually exclusive")
+	}
+	if in.TTL < 0 {
+		verr.add("ttl", "must be positive")
+	}
+	if in.ExpiresAt != nil && !in.ExpiresAt.After(now) {
+		verr.add("expiresAt", "must be in the future")
+	}
+
+	if _, err := time.LoadLocation(in.Timezone); err != nil {
+		verr.add("timezone", "unknown timezone %s", in.Timezone)
+	}
+
+	validateRedirects(verr, in.Redirects)
+
+	return verr.orNil()
+}
+
+// validateRedirects checks every window on its own, and that the daily
+// windows (the ones without weekdays or dates) cover the whole day exactly
+// once. Weekday and date windows override the daily ones and may overlap them.
+func validateRedirects(verr *ValidationError, redirects []shortlink.Redirect) {
+	if len(redirects) == 0 || len(redirects) > maxRedirects {
+		verr.add("redirects", "must contain between 1 and %d redirects", maxRedirects)
+		return
+	}
+
+	var coverage [dayMinutes]int
+	var hasDaily bool
+	for i, r := range redirects {
+		field := fmt.Sprintf("redirects[%d]", i)
+		if !validateRedirect(verr, field, r) {
+			continue
+		}
+		if redirectRank(r) > 0 {
+			continue
+		}
+
+		hasDaily = true
+		start, end := windowMinutes(r)
+		if end < start {
+			end += dayMinutes
+		}
+		var overlaps bool
+		for m := start; m < end; m++ {
+			if coverage[m%dayMinutes] > 0 {
+				overlaps = true
+			}
+			coverage[m%dayMinutes]++
+		}
+		if overlaps {
+			verr.add(field, "overlaps another daily window")
+		}
+	}
+	if !hasDaily {
+		if len(verr.Errors) == 0 {
+			verr.add("redirects", "must contain at least one daily window without weekdays or dates")
+		}
+		return
+	}
+
+	for _, gap := range coverageGaps(coverage[:]) {
+		verr.add("redirects", "no window covers %s-%s", formatMinute(gap[0]), formatMinute(gap[1]))
+	}
+}
+
+func validateRedirect(verr *ValidationError, field string, r shortlink.Redirect) bool {
+	n := len(verr.Errors)
+
+	if r.URL == "" {
+		verr.add(field+".url", "url not provided")
+	} else if _, err := url.ParseRequestURI(r.URL); err != nil {
+		verr.add(field+".url", "invalid url: %v", err)
+	}
+
+	if r.From < 0 || r.From > 23 {
+		verr.add(field+".from", "must be between 0 and 23")
+	}
+	if r.To < 0 || r.To > 24 {
+		verr.add(field+".to", "must be between 0 and 24")
+	}
+	if r.FromMinute < 0 || r.FromMinute > 59 {
+		verr.add(field+".fromMinute", "must be between 0 and 59")
+	}
+	if r.ToMinute < 0 || r.ToMinute > 59 || (r.To == 24 && r.ToMinute != 0) {
+		verr.add(field+".toMinute", "must be between 0 and 59, and 0 when to is 24")
+	}
+	if start, end := windowMinutes(r); start == end {
+		verr.add(field, "window must not be empty, use from 0 to 24 for the whole day")
+	}
+
+	seen := make(map[time.Weekday]bool)
+	for _, wd := range r.Weekdays {
+		if wd < time.Sunday || wd > time.Saturday {
+			verr.add(field+".weekdays", "invalid weekday %d, must be between 0 (Sunday) and 6", wd)
+		} else if seen[wd] {
+			verr.add(field+".weekdays", "duplicate weekday %d", wd)
+		}
+		seen[wd] = true
+	}
+
+	var start, end time.Time
+	var err error
+	if r.StartDate != "" {
+		if start, err = time.Parse(dateLayout, r.StartDate); err != nil {
+			verr.add(field+".startDate", "must be in %s format", dateLayout)
+		}
+	}
+	if r.EndDate != "" {
+		if end, err = time.Parse(dateLayout, r.EndDate); err != nil {
+			verr.add(field+".endDate", "must be in %s format", dateLayout)
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		verr.add(field+".endDate", "must not be before startDate")
+	}
+
+	return len(verr.Errors) == n
+}
+
+// coverageGaps returns the [start, end) minute ranges no window covers.
+func coverageGaps(coverage []int) [][2]int {
+	var gaps [][2]int
+	for m := 0; m < len(coverage); m++ {
+		if coverage[m] > 0 {
+			continue
+		}
+		start := m
+		for m < len(coverage) && coverage[m] == 0 {
+			m++
+		}
+		gaps = append(gaps, [2]int{start, m})
+	}
+	return gaps
+}
+
+func formatMinute(m int) string {
+	return fmt.Sprintf("%02d:%02d", m/60, m%60)
+}
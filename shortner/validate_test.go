@@ -0,0 +1,110 @@
+package shortner
+
+import (
+	"errors"
+	"shortlink-service/shortlink"
+	"testing"
+	"time"
+)
+
+func TestValidateInput(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		in     shortlink.Input
+		fields []string
+	}{
+		{
+			name: "valid",
+			in: shortlink.Input{Redirects: []shortlink.Redirect{
+				{From: 0, To: 12, URL: "https://google.com"},
+				{From: 12, To: 24, URL: "https://youtube.com"},
+				{From: 9, To: 17, Weekdays: []time.Weekday{time.Monday}, URL: "https://github.com"},
+			}},
+		},
+		{
+			name: "valid wrapping window",
+			in: shortlink.Input{Redirects: []shortlink.Redirect{
+				{From: 22, To: 6, URL: "https://google.com"},
+				{From: 6, To: 22, URL: "https://youtube.com"},
+			}},
+		},
+		{
+			name: "hours out of range",
+			in: shortlink.Input{Redirects: []shortlink.Redirect{
+				{From: -1, To: 25, URL: "https://google.com"},
+			}},
+			fields: []string{"redirects[0].from", "redirects[0].to"},
+		},
+		{
+			name: "empty window and bad url",
+			in: shortlink.Input{Redirects: []shortlink.Redirect{
+				{From: 0, To: 24, URL: "google"},
+				{From: 5, To: 5, URL: "https://google.com"},
+			}},
+			fields: []string{"redirects[0].url", "redirects[1]"},
+		},
+		{
+			name: "overlap and gap",
+			in: shortlink.Input{Redirects: []shortlink.Redirect{
+				{From: 0, To: 12, URL: "https://google.com"},
+				{From: 10, To: 20, URL: "https://youtube.com"},
+			}},
+			fields: []string{"redirects[1]", "redirects"},
+		},
+		{
+			name: "calendar fields",
+			in: shortlink.Input{Redirects: []shortlink.Redirect{
+				{From: 0, To: 24, URL: "https://google.com"},
+				{From: 0, To: 24, Weekdays: []time.Weekday{1, 1, 9}, StartDate: "2021-12-01", EndDate: "2021-11-01", URL: "https://google.com"},
+			}},
+			fields: []string{"redirects[1].weekdays", "redirects[1].weekdays", "redirects[1].endDate"},
+		},
+		{
+			name: "too many redirects",
+			in: shortlink.Input{
+				Redirects: make([]shortlink.Redirect, maxRedirects+1),
+			},
+			fields: []string{"redirects"},
+		},
+		{
+			name: "input fields",
+			in: shortlink.Input{
+				KeyType:   "short",
+				Alias:     "2021",
+				ExpiresAt: &past,
+				TTL:       -1,
+				Timezone:  "Mars/Olympus_Mons",
+				Redirects: []shortlink.Redirect{{From: 0, To: 24, URL: "https://google.com"}},
+			},
+			fields: []string{"keyType", "alias", "ttl", "ttl", "expiresAt", "timezone"},
+		},
+	}
+
+	for _, tt := range tests {
+		err := ValidateInput(&tt.in, now)
+		if len(tt.fields) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+
+		var verr *ValidationError
+		if !errors.As(err, &verr) || !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: expected validation error, got: %v", tt.name, err)
+			continue
+		}
+		if len(verr.Errors) != len(tt.fields) {
+			t.Errorf("%s: errors mismatch. expected: %v, got: %v", tt.name, tt.fields, verr.Errors)
+			continue
+		}
+		for i, fe := range verr.Errors {
+			if fe.Field != tt.fields[i] {
+				t.Errorf("%s: field mismatch. expected: %s, got: %s", tt.name, tt.fields[i], fe.Field)
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package shortner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shortlink-service/shortlink"
+	"sync"
+	"time"
+)
+
+const (
+	defaultVisitFlushInterval = time.Second
+	defaultVisitFlushSize     = 1000
+)
+
+// visitBuffer counts the visits per storage key until they are flushed.
+type visitBuffer struct {
+	sync.Mutex
+	counts map[string]int
+	// size is the number of keys that triggers a flush before the interval
+	size      int
+	full      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newVisitBuffer(size int) *visitBuffer {
+	return &visitBuffer{
+		counts: make(map[string]int),
+		size:   size,
+		full:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (b *visitBuffer) add(key string, n int) {
+	b.Lock()
+	b.counts[key] += n
+	full := len(b.counts) >= b.size
+	b.Unlock()
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *visitBuffer) pending(key string) int {
+	b.Lock()
+	defer b.Unlock()
+	return b.counts[key]
+}
+
+// take empties the buffer and returns its counts.
+func (b *visitBuffer) take() map[string]int {
+	b.Lock()
+	defer b.Unlock()
+	counts := b.counts
+	b.counts = make(map[string]int, len(counts))
+	return counts
+}
+
+// FlushVisits writes the buffered visits to storage. Visits that fail to be
+// written stay buffered for the next flush: only the keys of a
+// *shortlink.VisitsError, every count for any other error, as storage adds
+// none of them then.
+func (c *Client) FlushVisits(ctx context.Context) error {
+	if c.visits == nil {
+		return nil
+	}
+	counts := c.visits.take()
+	if len(counts) == 0 {
+		return nil
+	}
+	err := c.dbClient.AddVisits(ctx, counts)
+	if err != nil {
+		failed := counts
+		var visitsErr *shortlink.VisitsError
+		if errors.As(err, &visitsErr) {
+			// the other counts were added and must not be added again
+			failed = make(map[string]int, len(visitsErr.Keys))
+			for _, key := range visitsErr.Keys {
+				failed[key] = counts[key]
+			}
+		}
+		for key, n := range failed {
+			c.visits.add(key, n)
+		}
+		return err
+	}
+	return nil
+}
+
+// Close stops flushing the buffered visits in the background and writes
+// the remaining ones, it is called on shutdown.
+func (c *Client) Close(ctx context.Context) error {
+	if c.visits == nil {
+		return nil
+	}
+	c.visits.closeOnce.Do(func() {
+		close(c.visits.stop)
+	})
+	<-c.visits.done
+	return c.FlushVisits(ctx)
+}
+
+// startVisitFlusher flushes the buffered visits every interval, or earlier
+// when the buffer is full, until the client is closed.
+func (c *Client) startVisitFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer close(c.visits.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.visits.stop:
+				return
+			case <-ticker.C:
+			case <-c.visits.full:
+			}
+			err := c.FlushVisits(ctx)
+			if err != nil {
+				fmt.Printf("error flushing visits: %v\n", err)
+			}
+		}
+	}()
+}